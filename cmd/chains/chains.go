@@ -0,0 +1,142 @@
+// chains runs several independent Gibbs sampling chains with
+// different seeds in parallel, and compares their traces of
+// log-likelihood and topic-size entropy by the potential scale
+// reduction factor (R-hat) of Gelman and Rubin.  It reports R-hat at
+// each evaluated iteration, and warns if chains disagree.
+// Usage:
+/*
+  $GOPATH/bin/chains \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -topics=2 -chains=4 -trace=/tmp/trace
+*/
+// Alternatively, chains could run as separate jobs, e.g., by running
+// singlethread or multithread with different -seed and -trace, and
+// chains compares their traces:
+/*
+  $GOPATH/bin/chains -traces=/tmp/trace.0,/tmp/trace.1
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/train"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"log"
+	"math/rand"
+	"strings"
+)
+
+func main() {
+	flagVocab := flag.String("vocab", "./testdata/vocab", "Vocabulary file")
+	flagCorpus := flag.String("corpus", "./testdata/corpus", "Corpus file")
+	flagMinDocLen := flag.Int("minlen", 1, "minimum document length")
+	flagMaxDocLen := flag.Int("maxlen", -1, "maximum document length")
+	flagTopics := flag.Int("topics", 10, "Number of topics to be learned")
+	flagGibbsIter := flag.Int("gibbs_iter", 100, "Gibbs sampling iterations")
+	flagAlpha := flag.Float64("alpha", 0.01, "Topic prior")
+	flagBeta := flag.Float64("beta", 0.01, "Word prior")
+	flagOptimStart := flag.Int("optim_start", 10,
+		"The Gibbs sampling iteration since when it optimize hyperparams")
+	flagEvalLag := flag.Int("eval_lag", 1, "Evaluation lag")
+	flagKernel := flag.String("kernel", gibbs.SparseLDAKernel,
+		"Sampling kernel, sparselda or alias")
+	flagSeed := flag.Int64("seed", 0, "Seed of the first chain")
+	flagChains := flag.Int("chains", 4, "Number of chains")
+	flagThreshold := flag.Float64("rhat_threshold", 1.1,
+		"Chains disagree if R-hat is larger than this threshold")
+	flagTrace := flag.String("trace", "",
+		"Write the trace of chain i to file <trace>.i")
+	flagModel := flag.String("model", "",
+		"Write the model of chain i to file <model>.i")
+	flagTraces := flag.String("traces", "",
+		"Comma-separated trace files of separate jobs to be compared")
+	flag.Parse()
+
+	if len(*flagTraces) > 0 {
+		compareTraces(strings.Split(*flagTraces, ","), *flagThreshold)
+		return
+	}
+
+	vocab := utils.LoadVocabOrDie(*flagVocab)
+	models := make([]*gibbs.Model, *flagChains)
+	corpora := make([][]*gibbs.Document, *flagChains)
+	for i := range models {
+		// Each chain starts from a different random initialization.
+		rng := rand.New(utils.NewSource(*flagSeed + int64(i)))
+		corpora[i] = utils.LoadCorpusOrDie(*flagCorpus, vocab, *flagTopics,
+			*flagMinDocLen, *flagMaxDocLen, rng)
+		models[i] = utils.InitializeModel(corpora[i], vocab, *flagTopics,
+			*flagAlpha, *flagBeta)
+	}
+
+	opts := train.DefaultOptions()
+	opts.Kernel = *flagKernel
+	opts.Iterations = *flagGibbsIter
+	opts.OptimStart = *flagOptimStart
+	opts.EvalLag = *flagEvalLag
+	opts.Seed = *flagSeed
+	c, e := train.NewChains(models, corpora, opts, func(d *train.Diagnostics) {
+		report(d, *flagThreshold)
+	})
+	if e != nil {
+		log.Fatal(e)
+	}
+	if e := c.Run(context.Background()); e != nil {
+		log.Fatal(e)
+	}
+
+	for i, t := range c.Trainers {
+		if len(*flagTrace) > 0 {
+			if e := c.Traces[i].Save(
+				fmt.Sprintf("%s.%d", *flagTrace, i)); e != nil {
+				log.Print(e)
+			}
+		}
+		if len(*flagModel) > 0 {
+			if e := utils.SaveModel(t.Model,
+				fmt.Sprintf("%s.%d", *flagModel, i)); e != nil {
+				log.Print(e)
+			}
+		}
+	}
+}
+
+func report(d *train.Diagnostics, threshold float64) {
+	log.Printf("Iteration %04d R-hat over %d samples: "+
+		"log-likelihood %f entropy %f", d.Iteration, d.Samples,
+		d.LogLikelihood, d.Entropy)
+	if !d.Agree(threshold) {
+		log.Printf("WARNING: Iteration %04d chains disagree, R-hat > %f",
+			d.Iteration, threshold)
+	}
+}
+
+// compareTraces reports diagnostics at iterations that all traces
+// have reached.
+func compareTraces(files []string, threshold float64) {
+	traces := make([]*train.Trace, len(files))
+	for i, f := range files {
+		var e error
+		if traces[i], e = train.LoadTrace(f); e != nil {
+			log.Fatal(e)
+		}
+	}
+
+	for _, iter := range traces[0].Iterations {
+		for _, t := range traces {
+			if n := len(t.Iterations); n == 0 || t.Iterations[n-1] < iter {
+				return
+			}
+		}
+		d, e := train.Diagnose(traces, iter)
+		if e != nil {
+			log.Fatal(e)
+		}
+		report(d, threshold)
+	}
+}
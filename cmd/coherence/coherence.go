@@ -0,0 +1,53 @@
+// coherence prints the UMass and NPMI coherence of each topic in a
+// trained model, and the mean coherence of all topics, computed from
+// document co-occurrences of top words in a reference corpus.
+// Usage:
+/*
+  $GOPATH/bin/coherence \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -model=/tmp/model -len=10
+*/
+// For the definitions of scores, please refer to
+// gibbs.TopicCoherence.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"log"
+	"math/rand"
+)
+
+func main() {
+	flagModel := flag.String("model", "", "The binary format model file")
+	flagVocab := flag.String("vocab", "", "The vocabulary file")
+	flagCorpus := flag.String("corpus", "", "The reference corpus file")
+	flagMinDocLen := flag.Int("minlen", 1, "minimum document length")
+	flagMaxDocLen := flag.Int("maxlen", -1, "maximum document length")
+	flagTopWords := flag.Int("len", 10, "Number of top words per topic")
+	flag.Parse()
+
+	v := utils.LoadVocabOrDie(*flagVocab)
+	m := utils.LoadModelOrDie(*flagModel)
+	if e := utils.CheckModel(m, v); e != nil {
+		log.Fatal(e)
+	}
+	rng := rand.New(rand.NewSource(-1))
+	corpus := utils.LoadCorpusOrDie(*flagCorpus, v, m.NumTopics(),
+		*flagMinDocLen, *flagMaxDocLen, rng)
+
+	cs := gibbs.ComputeCoherence(m, corpus, *flagTopWords)
+	for _, c := range cs {
+		fmt.Printf("Topic %05d UMass %f NPMI %f:", c.Topic, c.UMass, c.NPMI)
+		for _, w := range c.Words {
+			fmt.Printf(" %s", v.Token(w))
+		}
+		fmt.Println()
+	}
+	umass, npmi := gibbs.MeanCoherence(cs)
+	fmt.Printf("Mean of %d topics UMass %f NPMI %f\n", len(cs), umass, npmi)
+}
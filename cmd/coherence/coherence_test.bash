@@ -0,0 +1,25 @@
+go install && \
+(cd ../singlethread && go install) && \
+$GOPATH/bin/singlethread \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -topics=2 \
+    -model=/tmp/coherence_model \
+    2>/dev/null && \
+$GOPATH/bin/coherence \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -model=/tmp/coherence_model \
+    -len=2 \
+    > /tmp/coherence 2>/dev/null
+
+R=$(tail -n 1 /tmp/coherence)
+E='Mean of 2 topics UMass'
+
+if [[ "$R" != "$E"* ]]; then
+    echo "Expecting $E ..."
+    echo "got $R"
+    exit -1
+fi
+
+echo "Test passed"
@@ -0,0 +1,384 @@
+// hypersearch searches for the number of topics and symmetric priors
+// that give the best model, by training a trial for each setting with
+// the in-process trainer.  Trials run in parallel.
+// Usage:
+/*
+  $GOPATH/bin/hypersearch \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -test_corpus=../singlethread/testdata/corpus \
+    -topics=2,4 -alpha=0.01,0.1 -beta=0.01 \
+    -results=/tmp/results -model=/tmp/best
+*/
+// In grid mode, it tries every combination of -topics, -alpha and
+// -beta.  In random mode, it tries -trials settings, each drawn
+// log-uniformly between the minimum and maximum of each list.
+//
+// With -score=perplexity, trials are scored by the perplexity of
+// -test_corpus, the lower the better.  With -score=coherence, they are
+// scored by the mean NPMI coherence on -corpus, the higher the better.
+//
+// A trial is stopped early, or pruned, if its held-out perplexity at
+// an evaluation iteration after -prune_start is worse than the median
+// of other trials at the same iteration.  Pruning requires
+// -test_corpus, as the training perplexity drops with more topics and
+// is not comparable between trials.  As trials run in parallel, which
+// trials are pruned may vary between runs.
+//
+// The results table has a line for each trial in tab-separated
+// columns: trial, topics, alpha, beta, iterations, status and score.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/train"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Trial struct {
+	Id         int
+	Topics     int
+	Alpha      float64
+	Beta       float64
+	Iterations int // iterations run
+	Status     string
+	Score      float64
+	model      *gibbs.Model
+}
+
+const (
+	kDone   = "done"
+	kPruned = "pruned"
+	kFailed = "failed"
+)
+
+var errPruned = errors.New("pruned")
+
+func main() {
+	flagVocab := flag.String("vocab", "", "Vocabulary file")
+	flagCorpus := flag.String("corpus", "", "Training corpus file")
+	flagTestCorpus := flag.String("test_corpus", "", "Held-out corpus file")
+	flagMinDocLen := flag.Int("minlen", 1, "minimum document length")
+	flagMaxDocLen := flag.Int("maxlen", -1, "maximum document length")
+	flagTopics := flag.String("topics", "10,20,50", "Numbers of topics")
+	flagAlpha := flag.String("alpha", "0.01,0.1", "Topic priors")
+	flagBeta := flag.String("beta", "0.01,0.1", "Word priors")
+	flagMode := flag.String("mode", "grid", "Search mode, grid or random")
+	flagTrials := flag.Int("trials", 10, "Number of trials in random mode")
+	flagSeed := flag.Int64("seed", -1, "Seed of random number generators")
+	flagParallel := flag.Int("parallel", 2, "Number of concurrent trials")
+	flagGibbsIter := flag.Int("gibbs_iter", 100, "Gibbs sampling iterations")
+	flagEvalLag := flag.Int("eval_lag", 10, "Evaluation lag")
+	flagKernel := flag.String("kernel", gibbs.SparseLDAKernel,
+		"Sampling kernel, sparselda or alias")
+	flagScore := flag.String("score", "perplexity",
+		"Score trials by perplexity or coherence")
+	flagHeldOutMethod := flag.String("heldout_method", gibbs.DocumentCompletion,
+		"Held-out estimator, completion or left-to-right")
+	flagCoherence := flag.Int("coherence_len", 10,
+		"Number of top words per topic to score coherence")
+	flagPruneStart := flag.Int("prune_start", 20,
+		"The Gibbs sampling iteration since when it prunes trials")
+	flagResults := flag.String("results", "", "Results table, stdout if empty")
+	flagModel := flag.String("model", "", "The best model output")
+	flag.Parse()
+
+	if *flagScore != "perplexity" && *flagScore != "coherence" {
+		log.Fatalf("Unknown score %s, expecting perplexity or coherence",
+			*flagScore)
+	}
+	if *flagScore == "perplexity" && len(*flagTestCorpus) <= 0 {
+		log.Fatal("-score=perplexity requires -test_corpus")
+	}
+
+	trials, e := makeTrials(*flagMode, *flagTopics, *flagAlpha, *flagBeta,
+		*flagTrials, rand.New(utils.NewSource(*flagSeed)))
+	if e != nil {
+		log.Fatal(e)
+	}
+	vocab := utils.LoadVocabOrDie(*flagVocab)
+	var pruner *pruner
+	if len(*flagTestCorpus) > 0 {
+		pruner = newPruner()
+	} else {
+		log.Print("Pruning is disabled without -test_corpus")
+	}
+
+	run := func(t *Trial) error {
+		rng := rand.New(utils.NewSource(*flagSeed))
+		corpus, e := utils.LoadCorpus(*flagCorpus, vocab, t.Topics,
+			*flagMinDocLen, *flagMaxDocLen, rng)
+		if e != nil {
+			return e
+		}
+		m, e := gibbs.MakeModel(t.Topics, vocab.Len(), t.Alpha, t.Beta)
+		if e != nil {
+			return e
+		}
+		for _, d := range corpus {
+			d.ApplyToModel(m)
+		}
+
+		opts := train.DefaultOptions()
+		opts.Kernel = *flagKernel
+		opts.Iterations = *flagGibbsIter
+		opts.EvalLag = *flagEvalLag
+		opts.Seed = *flagSeed
+		var heldOut func(*gibbs.Model) float64
+		if len(*flagTestCorpus) > 0 {
+			test, e := utils.LoadCorpus(*flagTestCorpus, vocab, t.Topics,
+				*flagMinDocLen, *flagMaxDocLen, rng)
+			if e != nil {
+				return e
+			}
+			if heldOut, e = train.HeldOut(test, *flagHeldOutMethod, 0,
+				*flagSeed); e != nil {
+				return e
+			}
+			opts.HeldOut = heldOut
+		}
+		opts.OnIteration = func(s *train.IterationStats) error {
+			t.Iterations = s.Iteration + 1
+			if !s.Evaluated {
+				return nil
+			}
+			pp := s.Perplexity
+			if s.HeldOutPerplexity > 0 {
+				pp = s.HeldOutPerplexity
+			}
+			log.Printf("Trial %d iteration %04d perplexity %f",
+				t.Id, s.Iteration, pp)
+			if pruner.report(t.Id, s.Iteration, pp) &&
+				s.Iteration >= *flagPruneStart {
+				return errPruned
+			}
+			return nil
+		}
+
+		trainer, e := train.New(m, corpus, opts)
+		if e != nil {
+			return e
+		}
+		if e := trainer.Run(context.Background()); e != nil {
+			return e
+		}
+
+		if *flagScore == "perplexity" {
+			t.Score = heldOut(m)
+		} else {
+			_, t.Score = gibbs.MeanCoherence(
+				gibbs.ComputeCoherence(m, corpus, *flagCoherence))
+		}
+		t.model = m
+		return nil
+	}
+
+	var best *Trial
+	var mutex sync.Mutex
+	better := func(a, b *Trial) bool {
+		if *flagScore == "perplexity" {
+			return a.Score < b.Score
+		}
+		return a.Score > b.Score
+	}
+
+	queue := make(chan *Trial)
+	var wg sync.WaitGroup
+	for i := 0; i < *flagParallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				log.Printf("Trial %d starts: topics %d alpha %g beta %g",
+					t.Id, t.Topics, t.Alpha, t.Beta)
+				switch e := run(t); e {
+				case nil:
+					t.Status = kDone
+				case errPruned:
+					t.Status = kPruned
+				default:
+					t.Status = kFailed
+					log.Printf("Trial %d failed: %v", t.Id, e)
+				}
+				log.Printf("Trial %d %s: score %f", t.Id, t.Status, t.Score)
+
+				mutex.Lock()
+				if t.Status == kDone && (best == nil || better(t, best)) {
+					if best != nil {
+						best.model = nil
+					}
+					best = t
+				} else {
+					t.model = nil
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, t := range trials {
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+
+	if e := saveResults(trials, *flagResults); e != nil {
+		log.Fatal(e)
+	}
+	if best == nil {
+		log.Fatal("No trial is done")
+	}
+	log.Printf("Best trial %d: topics %d alpha %g beta %g score %f",
+		best.Id, best.Topics, best.Alpha, best.Beta, best.Score)
+	if e := utils.SaveModel(best.model, *flagModel); e != nil {
+		log.Fatal(e)
+	}
+}
+
+// makeTrials returns trials of all combinations in grid mode, or n
+// trials drawn log-uniformly within ranges in random mode.
+func makeTrials(mode, topics, alpha, beta string, n int,
+	rng *rand.Rand) ([]*Trial, error) {
+	ks, e := parseList(topics)
+	if e != nil {
+		return nil, e
+	}
+	as, e := parseList(alpha)
+	if e != nil {
+		return nil, e
+	}
+	bs, e := parseList(beta)
+	if e != nil {
+		return nil, e
+	}
+
+	trials := make([]*Trial, 0)
+	switch mode {
+	case "grid":
+		for _, k := range ks {
+			for _, a := range as {
+				for _, b := range bs {
+					trials = append(trials, &Trial{Id: len(trials),
+						Topics: int(k), Alpha: a, Beta: b})
+				}
+			}
+		}
+	case "random":
+		for i := 0; i < n; i++ {
+			trials = append(trials, &Trial{Id: i,
+				Topics: int(math.Floor(logUniform(ks, rng) + 0.5)),
+				Alpha:  logUniform(as, rng),
+				Beta:   logUniform(bs, rng)})
+		}
+	default:
+		return nil, fmt.Errorf("Unknown mode %s, expecting grid or random", mode)
+	}
+	return trials, nil
+}
+
+// parseList parses comma-separated positive numbers.
+func parseList(s string) ([]float64, error) {
+	fs := strings.Split(s, ",")
+	r := make([]float64, len(fs))
+	for i, f := range fs {
+		var e error
+		if r[i], e = strconv.ParseFloat(strings.TrimSpace(f), 64); e != nil {
+			return nil, fmt.Errorf("Cannot parse %s: %v", s, e)
+		}
+		if r[i] <= 0 {
+			return nil, fmt.Errorf("%s contains non-positive values", s)
+		}
+	}
+	return r, nil
+}
+
+// logUniform draws log-uniformly between the minimum and maximum of vs.
+func logUniform(vs []float64, rng *rand.Rand) float64 {
+	min, max := vs[0], vs[0]
+	for _, v := range vs {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	if min == max {
+		return min
+	}
+	return math.Exp(math.Log(min) + rng.Float64()*(math.Log(max)-math.Log(min)))
+}
+
+func saveResults(trials []*Trial, filename string) error {
+	var w io.Writer = os.Stdout
+	if len(filename) > 0 {
+		f, e := os.Create(filename)
+		if e != nil {
+			return fmt.Errorf("Cannot create file %s: %v", filename, e)
+		}
+		defer f.Close()
+		w = f
+	}
+	b := bufio.NewWriter(w)
+	for _, t := range trials {
+		fmt.Fprintf(b, "%d\t%d\t%g\t%g\t%d\t%s\t%f\n", t.Id, t.Topics,
+			t.Alpha, t.Beta, t.Iterations, t.Status, t.Score)
+	}
+	return b.Flush()
+}
+
+// pruner implements the median stopping rule: a trial should stop if
+// its perplexity at an iteration is worse than the median of other
+// trials at the same iteration.
+type pruner struct {
+	mutex  sync.Mutex
+	curves map[int]map[int]float64 // iteration -> trial -> perplexity
+}
+
+func newPruner() *pruner {
+	return &pruner{curves: make(map[int]map[int]float64)}
+}
+
+// report records the perplexity of trial at iter, and returns true if
+// the trial should stop.  It never stops a trial if fewer than two
+// other trials have reached iter, or if p is nil.
+func (p *pruner) report(trial, iter int, perplexity float64) bool {
+	if p == nil {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	c, ok := p.curves[iter]
+	if !ok {
+		c = make(map[int]float64)
+		p.curves[iter] = c
+	}
+	others := make([]float64, 0, len(c))
+	for t, pp := range c {
+		if t != trial {
+			others = append(others, pp)
+		}
+	}
+	c[trial] = perplexity
+
+	if len(others) < 2 {
+		return false
+	}
+	sort.Float64s(others)
+	median := others[len(others)/2]
+	if len(others)%2 == 0 {
+		median = (others[len(others)/2-1] + median) / 2
+	}
+	return perplexity > median
+}
@@ -0,0 +1,26 @@
+go install && \
+$GOPATH/bin/hypersearch \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -test_corpus=../singlethread/testdata/corpus \
+    -topics=2,3 -alpha=0.1 -beta=0.01 \
+    -gibbs_iter=20 -eval_lag=5 \
+    -results=/tmp/hypersearch_results \
+    -model=/tmp/hypersearch_model \
+    2>/dev/null
+
+R=$(cut -f 2,6 /tmp/hypersearch_results | tr '\n\t' ' :')
+E='2:done 3:done '
+
+if [[ "$R" != "$E" ]]; then
+    echo "Expecting $E"
+    echo "got $R"
+    exit -1
+fi
+
+if [[ ! -s /tmp/hypersearch_model ]]; then
+    echo "Expecting the best model in /tmp/hypersearch_model"
+    exit -1
+fi
+
+echo "Test passed"
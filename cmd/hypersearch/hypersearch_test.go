@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMakeTrials(t *testing.T) {
+	ts, e := makeTrials("grid", "2,4", "0.1", "0.01,0.1", 0, nil)
+	if e != nil || len(ts) != 4 {
+		t.Fatalf("Expecting 4 grid trials, got %d, %v", len(ts), e)
+	}
+	if ts[3].Topics != 4 || ts[3].Alpha != 0.1 || ts[3].Beta != 0.1 {
+		t.Errorf("Unexpected trial %+v", ts[3])
+	}
+
+	ts, e = makeTrials("random", "2,8", "0.01,1", "0.1", 20,
+		rand.New(rand.NewSource(1)))
+	if e != nil || len(ts) != 20 {
+		t.Fatalf("Expecting 20 random trials, got %d, %v", len(ts), e)
+	}
+	for _, tr := range ts {
+		if tr.Topics < 2 || tr.Topics > 8 || tr.Alpha < 0.01 || tr.Alpha > 1 ||
+			tr.Beta != 0.1 {
+			t.Errorf("Trial out of range: %+v", tr)
+		}
+	}
+
+	if _, e := makeTrials("grid", "2,x", "0.1", "0.1", 0, nil); e == nil {
+		t.Errorf("Expecting error parsing 2,x")
+	}
+	if _, e := makeTrials("unknown", "2", "0.1", "0.1", 0, nil); e == nil {
+		t.Errorf("Expecting error for unknown mode")
+	}
+}
+
+func TestPruner(t *testing.T) {
+	p := newPruner()
+	if p.report(0, 10, 100) || p.report(1, 10, 120) {
+		t.Errorf("Expecting no pruning with fewer than 2 other trials")
+	}
+	if !p.report(2, 10, 130) {
+		t.Errorf("Expecting pruning 130 > median(100, 120)")
+	}
+	if p.report(3, 10, 105) {
+		t.Errorf("Expecting no pruning 105 < median(100, 120, 130)")
+	}
+	if p.report(4, 20, 1000) {
+		t.Errorf("Expecting no pruning at a new iteration")
+	}
+	if !p.report(5, 10, 118) {
+		t.Errorf("Expecting pruning 118 > median(100, 105, 120, 130)")
+	}
+	if p.report(0, 10, 90) {
+		t.Errorf("Expecting no pruning 90 < median(105, 118, 120, 130)")
+	}
+
+	var nilPruner *pruner
+	if nilPruner.report(0, 10, 1000) {
+		t.Errorf("Expecting no pruning by a nil pruner")
+	}
+}
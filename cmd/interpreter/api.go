@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/huichen/sego"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	kDefaultTopK      = 10
+	kDefaultTopWords  = 10
+	kMaxAPIIterations = 10000
+	kMaxAPIWords      = 10000   // max number of words of a document
+	kMaxAPIBodyBytes  = 1 << 20 // max size of a request body
+)
+
+// APIRequest is the JSON body of POST /api/v1/interpret.  Zero values
+// of optional fields mean defaults.
+type APIRequest struct {
+	// Words are pre-tokenized words.  If empty, Text is segmented into
+	// words, or split by white spaces if Segmented is true.
+	Text      string   `json:"text"`
+	Words     []string `json:"words"`
+	Segmented bool     `json:"segmented"`
+
+	// Method is "gibbs" (default) or "variational".  BurnIn,
+	// Iterations and Tolerance are as in gibbs.InterpretOptions and
+	// default to gibbs.DefaultInterpretOptions, except that BurnIn is
+	// 0 if only Iterations is set.
+	Method     string  `json:"method"`
+	BurnIn     int     `json:"burn_in"`
+	Iterations int     `json:"iterations"`
+	Tolerance  float64 `json:"tolerance"`
+
+	TopK      int     `json:"top_k"`     // max number of topics returned
+	Threshold float64 `json:"threshold"` // min probability of topics
+	TopWords  int     `json:"top_words"` // max number of words per topic
+}
+
+type APIResponse struct {
+	Words  []string   `json:"words"` // words of the input
+	Topics []APITopic `json:"topics"`
+}
+
+type APITopic struct {
+	Id    int32     `json:"id"`
+	Prob  float64   `json:"prob"`
+	Words []APIWord `json:"words"`
+}
+
+type APIWord struct {
+	Word  string `json:"word"`
+	Count int64  `json:"count"`
+}
+
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// NewAPIHandler returns the handler of POST /api/v1/interpret, which
+// responds with JSON encoded APIResponse, or APIError with status 4xx
+// for invalid requests, documents of more than kMaxAPIWords words, and
+// empty or all out-of-vocabulary documents.
+func NewAPIHandler(itr *gibbs.Interpreter, sgt *sego.Segmenter,
+	descs []*utils.TopicDesc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			writeJSON(w, http.StatusMethodNotAllowed,
+				APIError{"method must be POST"})
+			return
+		}
+
+		var req APIRequest
+		body := http.MaxBytesReader(w, r.Body, kMaxAPIBodyBytes)
+		if e := json.NewDecoder(body).Decode(&req); e != nil {
+			writeJSON(w, http.StatusBadRequest,
+				APIError{fmt.Sprintf("invalid request: %v", e)})
+			return
+		}
+		opts, e := req.options()
+		if e != nil {
+			writeJSON(w, http.StatusBadRequest, APIError{e.Error()})
+			return
+		}
+
+		words := req.Words
+		if len(words) == 0 {
+			if req.Segmented {
+				words = strings.Fields(req.Text)
+			} else {
+				words = segment(sgt, req.Text)
+			}
+		}
+		if len(words) > kMaxAPIWords {
+			writeJSON(w, http.StatusBadRequest,
+				APIError{fmt.Sprintf("%d words, more than %d",
+					len(words), kMaxAPIWords)})
+			return
+		}
+
+		dist, e := itr.InterpretWithOptions(words, opts)
+		if e != nil {
+			if e.Error() == gibbs.ErrEmptyDoc {
+				writeJSON(w, http.StatusUnprocessableEntity,
+					APIError{e.Error()})
+			} else {
+				writeJSON(w, http.StatusInternalServerError,
+					APIError{e.Error()})
+				log.Printf("Failed interpet %s: %v", words, e)
+			}
+			return
+		}
+
+		resp := APIResponse{Words: words, Topics: []APITopic{}}
+		for _, p := range dist {
+			if len(resp.Topics) >= req.TopK || p.Prob < req.Threshold {
+				break // dist is sorted by probabilities.
+			}
+			resp.Topics = append(resp.Topics, APITopic{
+				Id:    p.Topic,
+				Prob:  p.Prob,
+				Words: topWords(descs[p.Topic], req.TopWords)})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// MakeSafeAPI recovers panics of h, and responds with APIError and
+// status 500.
+func MakeSafeAPI(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				writeJSON(w, http.StatusInternalServerError,
+					APIError{fmt.Sprint(p)})
+				log.Printf("panic: %v", p)
+			}
+		}()
+		h(w, r)
+	}
+}
+
+// options fills in defaults of req, and returns the inference options
+// or an error if any parameter is invalid.
+func (req *APIRequest) options() (gibbs.InterpretOptions, error) {
+	opts := gibbs.DefaultInterpretOptions()
+	switch req.Method {
+	case "", "gibbs":
+		opts.Method = gibbs.Gibbs
+	case "variational":
+		opts.Method = gibbs.Variational
+	default:
+		return opts, fmt.Errorf("unknown method %q", req.Method)
+	}
+
+	if req.BurnIn < 0 || req.Iterations < 0 || req.Tolerance < 0 ||
+		req.TopK < 0 || req.TopWords < 0 {
+		return opts, fmt.Errorf("burn_in, iterations, tolerance, top_k " +
+			"and top_words must not be negative")
+	}
+	if req.Threshold < 0 || req.Threshold > 1 {
+		return opts, fmt.Errorf("threshold = %f, not in [0, 1]",
+			req.Threshold)
+	}
+	if req.Iterations > 0 {
+		opts.BurnIn, opts.Iterations = req.BurnIn, req.Iterations
+	} else if req.BurnIn > 0 {
+		opts.BurnIn = req.BurnIn
+	}
+	if req.Tolerance > 0 {
+		opts.Tolerance = req.Tolerance
+	}
+	if opts.Iterations > kMaxAPIIterations {
+		return opts, fmt.Errorf("iterations = %d, more than %d",
+			opts.Iterations, kMaxAPIIterations)
+	}
+	if opts.Method == gibbs.Gibbs && opts.Iterations <= opts.BurnIn {
+		return opts, fmt.Errorf("iterations (%d) <= burn_in (%d)",
+			opts.Iterations, opts.BurnIn)
+	}
+	if opts.Method == gibbs.Variational && opts.Iterations <= 0 {
+		return opts, fmt.Errorf("iterations must be positive")
+	}
+
+	if req.TopK == 0 {
+		req.TopK = kDefaultTopK
+	}
+	if req.TopWords == 0 {
+		req.TopWords = kDefaultTopWords
+	}
+	return opts, nil
+}
+
+// topWords returns at most n top words of a topic.
+func topWords(desc *utils.TopicDesc, n int) []APIWord {
+	words := []APIWord{}
+	if desc != nil {
+		for _, t := range desc.Tokens {
+			if len(words) >= n {
+				break
+			}
+			words = append(words, APIWord{string(t.Word), t.Count})
+		}
+	}
+	return words
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if e := json.NewEncoder(w).Encode(v); e != nil {
+		log.Printf("Cannot encode JSON response: %v", e)
+	}
+}
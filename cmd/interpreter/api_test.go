@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIHandler(t *testing.T) {
+	m, v, e := gibbs.CreateTestingOptimizedModel()
+	if e != nil {
+		t.Skip(e)
+	}
+	h := NewAPIHandler(gibbs.NewInterpreter(m, v, -1), nil,
+		utils.DescribeTopics(m, v, 10))
+
+	// resp omits top words, as words of the same counts are not
+	// ordered.  nwords is the number of top words of each topic.
+	type testCase struct {
+		method string
+		body   string
+		status int
+		resp   string
+		nwords int
+	}
+	testCases := []testCase{
+		{"GET", "", http.StatusMethodNotAllowed, "", 0},
+		{"POST", "{", http.StatusBadRequest, "", 0},
+		{"POST", `{"words": ["apple"], "method": "unknown"}`,
+			http.StatusBadRequest, "", 0},
+		{"POST", `{"words": ["apple"], "burn_in": 10, "iterations": 10}`,
+			http.StatusBadRequest, "", 0},
+		{"POST", `{"words": ["apple"], "threshold": 2}`,
+			http.StatusBadRequest, "", 0},
+		{"POST", `{"words": []}`, http.StatusUnprocessableEntity, "", 0},
+		{"POST", `{"text": "unknown", "segmented": true}`,
+			http.StatusUnprocessableEntity, "", 0},
+		{"POST", `{"text": "orange  apple", "segmented": true,` +
+			` "method": "variational", "top_k": 1, "top_words": 1}`,
+			http.StatusOK, "{[orange apple] [{0 0.9998137450130447 []}]}", 1},
+		{"POST", `{"words": ["tiger", "cat"], "method": "variational",` +
+			` "threshold": 0.5}`,
+			http.StatusOK, "{[tiger cat] [{1 0.9998125194125845 []}]}", 2},
+		{"POST", `{"words": ["tiger", "apple"], "iterations": 100}`,
+			http.StatusOK, "{[tiger apple] [{0 0.5454545454545454 []} " +
+				"{1 0.45454545454545453 []}]}", 2},
+	}
+	testCases = append(testCases, testCase{"POST", `{"text": "` +
+		strings.Repeat("apple ", kMaxAPIWords+1) + `", "segmented": true}`,
+		http.StatusBadRequest, "", 0})
+	for _, c := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(c.method, "/api/v1/interpret",
+			strings.NewReader(c.body))
+		h(w, r)
+		if w.Code != c.status {
+			t.Errorf("%s %s: expecting status %d, got %d: %s",
+				c.method, c.body, c.status, w.Code, w.Body)
+			continue
+		}
+		if c.status != http.StatusOK {
+			var a APIError
+			if e := json.Unmarshal(w.Body.Bytes(), &a); e != nil ||
+				len(a.Error) == 0 {
+				t.Errorf("%s: expecting an APIError, got %s", c.body, w.Body)
+			}
+			continue
+		}
+
+		var resp APIResponse
+		if e := json.Unmarshal(w.Body.Bytes(), &resp); e != nil {
+			t.Errorf("%s: cannot decode %s: %v", c.body, w.Body, e)
+			continue
+		}
+		for i := range resp.Topics {
+			if n := len(resp.Topics[i].Words); n != c.nwords {
+				t.Errorf("%s: expecting %d top words, got %d",
+					c.body, c.nwords, n)
+			}
+			resp.Topics[i].Words = nil
+		}
+		if s := fmt.Sprint(resp); s != c.resp {
+			t.Errorf("%s: expecting %s, got %s", c.body, c.resp, s)
+		}
+	}
+}
+
+func TestMakeSafeAPI(t *testing.T) {
+	h := MakeSafeAPI(func(http.ResponseWriter, *http.Request) {
+		panic("not an error")
+	})
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/api/v1/interpret", nil)
+	h(w, r)
+	var a APIError
+	if e := json.Unmarshal(w.Body.Bytes(), &a); e != nil ||
+		w.Code != http.StatusInternalServerError || a.Error != "not an error" {
+		t.Errorf("Expecting status 500 and APIError, got %d %s",
+			w.Code, w.Body)
+	}
+}
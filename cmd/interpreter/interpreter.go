@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/huichen/sego"
 	"github.com/wangkuiyi/phoenix/core/gibbs"
 	"github.com/wangkuiyi/phoenix/core/utils"
@@ -22,7 +23,10 @@ func main() {
 	flag.Parse()
 
 	sgt := CreateSegmenter(*flagSegmentor)
-	m, v, itr := CreateInterpreter(*flagModel, *flagVocab, *flagCache)
+	m, v, itr, e := CreateInterpreter(*flagModel, *flagVocab, *flagCache)
+	if e != nil {
+		log.Fatalf("Cannot create interpreter: %v", e)
+	}
 	if len(*flagTrans) > 0 {
 		v = utils.TranslatedVocab(v,
 			utils.LoadTranslationOrDie(*flagTrans))
@@ -30,6 +34,8 @@ func main() {
 	descs := utils.DescribeTopics(m, v, *flagMaxWordsPerTopic)
 
 	http.HandleFunc("/", MakeSafe(NewHandler(itr, sgt, descs)))
+	http.HandleFunc("/api/v1/interpret",
+		MakeSafeAPI(NewAPIHandler(itr, sgt, descs)))
 	log.Printf("Listening on %s", *flagAddr)
 	if e := http.ListenAndServe(*flagAddr, nil); e != nil {
 		log.Fatalf("ListenAndServe failed: %v", e)
@@ -37,13 +43,22 @@ func main() {
 }
 
 func CreateInterpreter(model, vocab string, cache int) (
-	*gibbs.Model, *gibbs.Vocabulary, *gibbs.Interpreter) {
-	m := utils.LoadModelOrDie(model)
-	v := utils.LoadVocabOrDie(vocab)
+	*gibbs.Model, *gibbs.Vocabulary, *gibbs.Interpreter, error) {
+	m, e := utils.LoadModel(model)
+	if e != nil {
+		return nil, nil, nil, e
+	}
+	v, e := utils.LoadVocab(vocab)
+	if e != nil {
+		return nil, nil, nil, e
+	}
+	if e := utils.CheckModel(m, v); e != nil {
+		return nil, nil, nil, e
+	}
 	log.Printf("Smoothing model and creating interpreter ...")
 	intr := gibbs.NewInterpreter(m, v, cache)
 	log.Printf("Done")
-	return m, v, intr
+	return m, v, intr, nil
 }
 
 func CreateSegmenter(segmenter string) *sego.Segmenter {
@@ -73,32 +88,36 @@ func NewHandler(itr *gibbs.Interpreter, sgt *sego.Segmenter,
 		log.Fatal("Cannot parse template interpret from kTemplate.")
 	}
 
+	// itr is shared by concurrent requests, which is safe.
+	opts := gibbs.DefaultInterpretOptions()
 	return func(w http.ResponseWriter, r *http.Request) {
-		var data []Topic
+		var data Page
 
 		if q := r.FormValue("q"); len(q) > 0 {
-			text := make([]string, 0, len(strings.Fields(q)))
-			for _, seg := range sgt.Segment([]byte(q)) {
-				text = append(text, seg.Token().Text())
-			}
+			text := segment(sgt, q)
 			log.Printf("query text: %v", text)
 
-			dist, e := itr.Interpret(text, 50, 150)
-			if e != nil {
+			dist, attrs, e := itr.InterpretWithAttribution(text,
+				opts.BurnIn, opts.Iterations)
+			if e != nil && e.Error() != gibbs.ErrEmptyDoc {
 				http.Error(w, e.Error(), http.StatusInternalServerError)
 				log.Printf("Failed interpet %s: %v", text, e)
 				return
 			}
 
 			numTopics := len(dist)
-			if numTopics > 10 {
-				numTopics = 10
+			if numTopics > len(kTopicColors) {
+				numTopics = len(kTopicColors)
 			}
-			data = make([]Topic, numTopics)
+			colors := make(map[int32]string)
+			data.Topics = make([]Topic, numTopics)
 			for i := 0; i < numTopics; i++ {
-				data[i].Weight = dist[i].Prob
-				data[i].Desc = descs[dist[i].Topic]
+				data.Topics[i].Weight = dist[i].Prob
+				data.Topics[i].Desc = descs[dist[i].Topic]
+				data.Topics[i].Color = kTopicColors[i]
+				colors[dist[i].Topic] = kTopicColors[i]
 			}
+			data.Words = makeWords(attrs, colors)
 		}
 
 		if e := tmpl.Execute(w, data); e != nil {
@@ -109,9 +128,53 @@ func NewHandler(itr *gibbs.Interpreter, sgt *sego.Segmenter,
 	}
 }
 
+// segment segments q into words.
+func segment(sgt *sego.Segmenter, q string) []string {
+	text := make([]string, 0, len(strings.Fields(q)))
+	for _, seg := range sgt.Segment([]byte(q)) {
+		text = append(text, seg.Token().Text())
+	}
+	return text
+}
+
+// makeWords colors words by their attributed topics.  Words attributed
+// to topics not in colors are in kOtherTopicColor.
+func makeWords(attrs []gibbs.Attribution, colors map[int32]string) []Word {
+	words := make([]Word, len(attrs))
+	for i, a := range attrs {
+		words[i].Text = a.Word
+		if a.OOV {
+			words[i].OOV = true
+			words[i].Title = "out of vocabulary"
+			continue
+		}
+		if c, ok := colors[a.Topic]; ok {
+			words[i].Color = c
+		} else {
+			words[i].Color = kOtherTopicColor
+		}
+		words[i].Title = fmt.Sprintf("topic %d, confidence %.2f",
+			a.Topic, a.Confidence)
+	}
+	return words
+}
+
+type Page struct {
+	Words  []Word  // the input text colored by topics
+	Topics []Topic // top topics of the input
+}
+
+type Word struct {
+	Text  string
+	Color string // background color of the attributed topic
+	Title string // the attributed topic and confidence
+	OOV   bool
+}
+
 type Topic struct {
 	Weight float64
 	Desc   *utils.TopicDesc
+	Color  string
 }
 
 const (
@@ -126,17 +189,32 @@ const (
       <input type="textarea" name="q" size=80>
       <input type="submit" value="Interpret"></input>
     </form>
+    {{with .Words}}
+    <p style="font-size: 20px;">
+      {{range .}}
+      {{if .OOV}}
+      <span style="color: gray; text-decoration: line-through;"
+            title="{{.Title}}">{{.Text}}</span>
+      {{else}}
+      <span style="background-color: {{.Color}};"
+            title="{{.Title}}">{{.Text}}</span>
+      {{end}}
+      {{end}}
+    </p>
+    {{end}}
     <table>
       <thead style="border: 1px; background-color: #0198E1; color: yellow;">
         <tr>
+          <td></td>
           <td>P(topic|input)</td>
           <td>N(topic)</td>
           <td colspan=100>P(word|topic)</td>
         </tr>
       </thead>
       <tbody style="background-color: #BFEFFF; border: 1px;">
-        {{range .}}
+        {{range .Topics}}
         <tr>
+          <td style="background-color: {{.Color}};">&nbsp;&nbsp;</td>
           <td>{{.Weight}}</td>
           {{with .Desc}}
           <td>{{.Nt}}</td>
@@ -153,4 +231,12 @@ const (
 </html>
 `
 	kMaxTopNWord = 50
+
+	kOtherTopicColor = "#DDDDDD"
 )
+
+// kTopicColors are colors of the top topics of an input.
+var kTopicColors = []string{
+	"#FF9999", "#99FF99", "#9999FF", "#FFFF66", "#FF99FF",
+	"#66FFFF", "#FFCC66", "#CC99FF", "#99CC66", "#FF6666",
+}
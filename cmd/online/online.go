@@ -0,0 +1,121 @@
+// online is a command line trainer that folds a batch of new
+// documents into an existing model, without retraining from scratch.
+// Usage:
+/*
+  $GOPATH/bin/online \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -model=/tmp/model -output=/tmp/model.new \
+    -assignments=/tmp/assignments -decay=0.9
+*/
+// If -model is empty, online starts from an empty model with -topics
+// topics.  Each line of the -assignments file corresponds to a
+// document in -corpus that is not filtered out, and consists of
+// token:topic pairs.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+)
+
+func main() {
+	flagVocab := flag.String("vocab", "./testdata/vocab", "Vocabulary file")
+	flagCorpus := flag.String("corpus", "./testdata/corpus",
+		"Corpus file of new documents")
+	flagMinDocLen := flag.Int("minlen", 1, "minimum document length")
+	flagMaxDocLen := flag.Int("maxlen", -1, "maximum document length")
+	flagModel := flag.String("model", "", "The existing model")
+	flagTopics := flag.Int("topics", 10, "Number of topics if no -model")
+	flagAlpha := flag.Float64("alpha", 0.01, "Topic prior if no -model")
+	flagBeta := flag.Float64("beta", 0.01, "Word prior if no -model")
+	flagDecay := flag.Float64("decay", 1.0,
+		"Multiply counts of the existing model by decay before folding in")
+	flagGibbsIter := flag.Int("gibbs_iter", 100, "Gibbs sampling iterations")
+	flagKernel := flag.String("kernel", gibbs.SparseLDAKernel,
+		"Sampling kernel, sparselda or alias")
+	flagCache := flag.Int("cache", 0, "Smoothing model cache in MB")
+	flagOutput := flag.String("output", "", "The updated model output")
+	flagAssignments := flag.String("assignments", "",
+		"Topic assignments of new documents")
+	flag.Parse()
+
+	vocab := utils.LoadVocabOrDie(*flagVocab)
+	var model *gibbs.Model
+	if len(*flagModel) > 0 {
+		model = utils.LoadModelOrDie(*flagModel)
+		if e := utils.CheckModel(model, vocab); e != nil {
+			log.Fatal(e)
+		}
+	} else {
+		model = gibbs.NewModel(*flagTopics, vocab.Len(), *flagAlpha, *flagBeta)
+	}
+
+	rng := rand.New(rand.NewSource(-1))
+	corpus := utils.LoadCorpusOrDie(*flagCorpus, vocab, model.NumTopics(),
+		*flagMinDocLen, *flagMaxDocLen, rng)
+
+	if *flagDecay < 1.0 {
+		log.Printf("Decaying model by %f", *flagDecay)
+		model.Decay(*flagDecay)
+	}
+
+	sampler, e := gibbs.NewKernel(*flagKernel, model)
+	if e != nil {
+		log.Fatal(e)
+	}
+	log.Printf("Folding in %d documents ...", len(corpus))
+	gibbs.FoldIn(model, corpus, sampler, *flagGibbsIter, rng)
+
+	s := gibbs.NewSampler(model)
+	eval := gibbs.NewEvaluator(model, *flagCache, s)
+	logL := 0.0
+	nW := 0
+	for _, d := range corpus {
+		ll, nw := eval.Perplexity(d)
+		logL += ll
+		nW += nw
+	}
+	log.Printf("Perplexity of new documents %f", math.Exp(-logL/float64(nW)))
+
+	if e := utils.SaveModel(model, *flagOutput); e != nil {
+		log.Fatal(e)
+	}
+	saveAssignments(corpus, vocab, *flagAssignments)
+}
+
+func saveAssignments(corpus []*gibbs.Document, vocab *gibbs.Vocabulary,
+	filename string) {
+	if len(filename) <= 0 {
+		return
+	}
+
+	f, e := os.Create(filename)
+	if e != nil {
+		log.Fatalf("Cannot create file %s: %v", filename, e)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, d := range corpus {
+		for i := range d.Words {
+			if i > 0 {
+				fmt.Fprint(w, " ")
+			}
+			fmt.Fprintf(w, "%s:%d", vocab.Token(d.Words[i]), d.Topics[i])
+		}
+		fmt.Fprintln(w)
+	}
+	if e := w.Flush(); e != nil {
+		log.Fatalf("Failed writing %s: %v", filename, e)
+	}
+	log.Printf("Saved assignments to %s.", filename)
+}
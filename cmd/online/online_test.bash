@@ -0,0 +1,29 @@
+go install && \
+$GOPATH/bin/online \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -topics=2 \
+    -output=/tmp/online_model \
+    2>/dev/null && \
+$GOPATH/bin/online \
+    -vocab=../singlethread/testdata/vocab \
+    -corpus=../singlethread/testdata/corpus \
+    -model=/tmp/online_model \
+    -decay=0.5 \
+    -assignments=/tmp/a \
+    2>/dev/null
+
+E='apple:0 orange:0
+orange:0 banana:0
+tiger:1 cat:1
+cat:1 dog:1'
+
+R=$(cat /tmp/a)
+
+if [[ "$R" != "$E" ]]; then
+    echo "Expecting $E"
+    echo "got $R"
+    exit -1
+fi
+
+echo "Test passed"
@@ -0,0 +1,116 @@
+// synth generates a synthetic corpus from known LDA parameters, or
+// scores a model trained on the corpus against the parameters.
+// Usage:
+/*
+  $GOPATH/bin/synth \
+    -topics=10 -vocab_size=1000 -alpha=0.1 -beta=0.01 \
+    -docs=1000 -doclen=100 -doclen_dist=poisson \
+    -vocab=/tmp/vocab -corpus=/tmp/corpus -truth=/tmp/truth
+
+  $GOPATH/bin/singlethread \
+    -vocab=/tmp/vocab -corpus=/tmp/corpus -topics=10 -model=/tmp/model
+
+  $GOPATH/bin/synth -vocab=/tmp/vocab -truth=/tmp/truth -model=/tmp/model
+*/
+// If -model is given, synth loads the vocabulary and the ground truth,
+// and prints the recovery score defined by synth.Recovery and the
+// topic of the model matched to each topic of the ground truth.
+// Otherwise, it generates the vocabulary, the corpus and the ground
+// truth.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/synth"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+func main() {
+	flagTopics := flag.Int("topics", 10, "Number of topics")
+	flagVocabSize := flag.Int("vocab_size", 1000, "Vocabulary size")
+	flagAlpha := flag.Float64("alpha", 0.1, "Symmetric topic prior")
+	flagBeta := flag.Float64("beta", 0.01, "Symmetric word prior")
+	flagDocs := flag.Int("docs", 1000, "Number of documents")
+	flagDocLen := flag.Float64("doclen", 100, "(Mean) document length")
+	flagDocLenDist := flag.String("doclen_dist", "poisson",
+		"Distribution of document lengths, poisson or fixed")
+	flagSeed := flag.Int64("seed", -1, "Seed of the random number generator")
+	flagVocab := flag.String("vocab", "", "The vocabulary file")
+	flagCorpus := flag.String("corpus", "", "The corpus output")
+	flagTruth := flag.String("truth", "", "The ground truth file")
+	flagModel := flag.String("model", "", "The model to be scored")
+	flag.Parse()
+
+	if len(*flagModel) > 0 {
+		score(*flagVocab, *flagTruth, *flagModel)
+		return
+	}
+
+	var docLen synth.DocLen
+	switch *flagDocLenDist {
+	case "poisson":
+		docLen = synth.PoissonLen(*flagDocLen)
+	case "fixed":
+		docLen = synth.FixedLen(int(*flagDocLen))
+	default:
+		log.Fatalf("Unknown -doclen_dist %s, expecting poisson or fixed",
+			*flagDocLenDist)
+	}
+
+	rng := rand.New(rand.NewSource(*flagSeed))
+	g := synth.NewGroundTruth(*flagTopics, *flagVocabSize, *flagAlpha,
+		*flagBeta, rng)
+	if e := writeLines(*flagVocab, g.Tokens); e != nil {
+		log.Fatal(e)
+	}
+	corpus := g.Corpus(*flagDocs, docLen, rng)
+	lines := make([]string, len(corpus))
+	for i, d := range corpus {
+		lines[i] = strings.Join(d, " ")
+	}
+	if e := writeLines(*flagCorpus, lines); e != nil {
+		log.Fatal(e)
+	}
+	if e := g.Save(*flagTruth); e != nil {
+		log.Fatal(e)
+	}
+	log.Printf("Generated %d documents of %d topics over %d tokens.",
+		len(corpus), g.NumTopics(), len(g.Tokens))
+}
+
+func score(vocabFile, truthFile, modelFile string) {
+	v := utils.LoadVocabOrDie(vocabFile)
+	m := utils.LoadModelOrDie(modelFile)
+	g, e := synth.LoadGroundTruth(truthFile)
+	if e != nil {
+		log.Fatal(e)
+	}
+	s, matching, e := synth.Recovery(g, m, v)
+	if e != nil {
+		log.Fatal(e)
+	}
+	fmt.Printf("Recovery %f\n", s)
+	for k, t := range matching {
+		fmt.Printf("Truth topic %05d matched model topic %d\n", k, t)
+	}
+}
+
+func writeLines(filename string, lines []string) error {
+	f, e := os.Create(filename)
+	if e != nil {
+		return fmt.Errorf("Cannot create file %s: %v", filename, e)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+	return w.Flush()
+}
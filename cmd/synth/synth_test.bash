@@ -0,0 +1,27 @@
+go install && \
+(cd ../singlethread && go install) && \
+$GOPATH/bin/synth \
+    -topics=3 -vocab_size=30 -alpha=0.1 -beta=0.05 \
+    -docs=300 -doclen=30 \
+    -vocab=/tmp/synth_vocab -corpus=/tmp/synth_corpus \
+    -truth=/tmp/synth_truth \
+    2>/dev/null && \
+$GOPATH/bin/singlethread \
+    -vocab=/tmp/synth_vocab -corpus=/tmp/synth_corpus \
+    -topics=3 -alpha=0.1 -beta=0.05 -gibbs_iter=100 \
+    -model=/tmp/synth_model \
+    2>/dev/null && \
+$GOPATH/bin/synth \
+    -vocab=/tmp/synth_vocab -truth=/tmp/synth_truth \
+    -model=/tmp/synth_model \
+    > /tmp/synth_score 2>/dev/null
+
+R=$(head -n 1 /tmp/synth_score | cut -d ' ' -f 2)
+
+if ! awk "BEGIN { exit !($R > 0.8) }"; then
+    echo "Expecting recovery > 0.8"
+    echo "got $R"
+    exit -1
+fi
+
+echo "Test passed"
@@ -0,0 +1,91 @@
+package gibbs
+
+import (
+	"math/rand"
+)
+
+// aliasTable implements Walker's alias method, as improved by Michael
+// Vose, for drawing from a fixed discrete distribution in O(1) time.
+// Building a table of n outcomes takes O(n) time.  Slices are reused
+// across rebuilds to avoid memory re-allocation.
+type aliasTable struct {
+	prob  []float64
+	alias []int32
+	small []int32
+	large []int32
+}
+
+// build makes the table represent the distribution proportional to
+// weights, whose sum is sum.  All weights must be non-negative and
+// sum must be positive.
+func (a *aliasTable) build(weights []float64, sum float64) {
+	n := len(weights)
+	a.prob = resizeFloat64s(a.prob, n)
+	a.alias = resizeInt32s(a.alias, n)
+	a.small = a.small[:0]
+	a.large = a.large[:0]
+
+	scale := float64(n) / sum
+	for i, w := range weights {
+		a.prob[i] = w * scale
+		a.alias[i] = int32(i)
+		if a.prob[i] < 1.0 {
+			a.small = append(a.small, int32(i))
+		} else {
+			a.large = append(a.large, int32(i))
+		}
+	}
+
+	for len(a.small) > 0 && len(a.large) > 0 {
+		s := a.small[len(a.small)-1]
+		a.small = a.small[:len(a.small)-1]
+		l := a.large[len(a.large)-1]
+
+		a.alias[s] = l
+		a.prob[l] -= 1.0 - a.prob[s]
+		if a.prob[l] < 1.0 {
+			a.large = a.large[:len(a.large)-1]
+			a.small = append(a.small, l)
+		}
+	}
+
+	// Outcomes left in either list have probability 1 up to rounding
+	// errors.
+	for _, i := range a.large {
+		a.prob[i] = 1.0
+	}
+	for _, i := range a.small {
+		a.prob[i] = 1.0
+	}
+}
+
+func (a *aliasTable) Len() int {
+	return len(a.prob)
+}
+
+// sample draws an outcome using a single random number.
+func (a *aliasTable) sample(rng *rand.Rand) int {
+	u := rng.Float64() * float64(len(a.prob))
+	i := int(u)
+	if i >= len(a.prob) { // guards against rounding up
+		i = len(a.prob) - 1
+	}
+	if u-float64(i) < a.prob[i] {
+		return i
+	}
+	return int(a.alias[i])
+}
+
+func resizeFloat64s(s []float64, n int) []float64 {
+	if cap(s) < n {
+		return make([]float64, n)
+	}
+	return s[:n]
+}
+
+func resizeInt32s(s []int32, n int) []int32 {
+	if cap(s) < n {
+		return make([]int32, n)
+	}
+	return s[:n]
+}
@@ -0,0 +1,296 @@
+package gibbs
+
+import (
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// DefaultMHSteps is the default number of Metropolis-Hastings
+	// steps that AliasSampler takes for each token.  Each step
+	// consists of a word-proposal and a doc-proposal.
+	DefaultMHSteps = 2
+)
+
+// AliasSampler implements the Metropolis-Hastings sampling algorithm
+// with alias tables as described in the paper *LightLDA: Big Topic
+// Models on Modest Computer Clusters* by Jinhui Yuan et al. at WWW in
+// 2015.  The cost of sampling a token does not depend on the number
+// of topics, which makes AliasSampler preferrable to Sampler when
+// there are thousands or more topics.
+//
+// For token w in document d, whose current topic is s, the target
+// distribution is
+/*
+                        n_kw + b
+   p(k) ∝ (n_dk + a_k) ----------
+                        n_k + bV
+*/
+// where counts exclude the current token.  AliasSampler alternates
+// between two proposals:
+/*
+                   n_kw + b
+   word:  q_w(k) ∝ ----------,      doc:  q_d(k) ∝ n_dk + a_k
+                   n_k + bV
+*/
+// The word-proposal is drawn from an alias table, which might be
+// stale, i.e., built from counts before some recent updates.
+// Acceptance rates are computed from the very values used to build
+// the table, so staleness does not bias the sampler, except that, as
+// in LightLDA, the table also counts the token being sampled.  This
+// bias is of order 1/n_w, where n_w is the frequency of word w, and
+// is negligible on real corpora.  The word-proposal is decomposed
+// into a sparse part n_kw/(n_k+bV), whose alias table is per-word and
+// has #non-zeros outcomes, and a smoothing part b/(n_k+bV), which is
+// shared by all words.  Each table is rebuilt after it has been drawn
+// as many times as its size, so the amortized cost of a draw is O(1).
+//
+// The doc-proposal is drawn by either picking the topic of a random
+// token in d, or, with probability \sum_k a_k / (L_d + \sum_k a_k),
+// drawing from an alias table of the topic prior.
+type AliasSampler struct {
+	model   *Model
+	diff    *Model
+	MHSteps int
+
+	priorTable *aliasTable
+
+	smoothingWeights []float64 // b/(n_k+bV), maybe stale
+	smoothingSum     float64
+	smoothingTable   *aliasTable
+	smoothingDraws   int
+
+	words []*wordProposal // indexed by token, built lazily
+
+	// docTopicCounts is a dense copy of the document topic histogram
+	// of the document being sampled.  It allows O(1) access to n_dk.
+	// Only topics in the document are non-zeros.
+	docTopicCounts []int32
+}
+
+// wordProposal is the sparse part of the word-proposal of a token.
+type wordProposal struct {
+	topics  []int32
+	weights []float64         // n_kw/(n_k+bV), maybe stale
+	index   map[int32]float64 // weights indexed by topic
+	sum     float64
+	table   aliasTable
+	draws   int
+}
+
+func NewAliasSampler(m *Model) *AliasSampler {
+	s := &AliasSampler{
+		model:            m,
+		MHSteps:          DefaultMHSteps,
+		priorTable:       new(aliasTable),
+		smoothingWeights: make([]float64, m.NumTopics()),
+		smoothingTable:   new(aliasTable),
+		words:            make([]*wordProposal, m.VocabSize()),
+		docTopicCounts:   make([]int32, m.NumTopics()),
+	}
+	s.AfterOptimization()
+	return s
+}
+
+// SetDiff is the same as Sampler.SetDiff.
+func (s *AliasSampler) SetDiff(d *Model) {
+	s.diff = d
+}
+
+// GetDiff is the same as Sampler.GetDiff.
+func (s *AliasSampler) GetDiff() *Model {
+	return s.diff
+}
+
+// AfterOptimization rebuilds the alias table of the topic prior and
+// invalidates all word-proposals.
+func (s *AliasSampler) AfterOptimization() {
+	s.priorTable.build(s.model.TopicPrior, s.model.TopicPriorSum)
+	s.buildSmoothingTable()
+	for i := range s.words {
+		if s.words[i] != nil {
+			s.words[i].draws = s.words[i].table.Len()
+		}
+	}
+}
+
+func (s *AliasSampler) buildSmoothingTable() {
+	s.smoothingSum = 0
+	for t := range s.smoothingWeights {
+		s.smoothingWeights[t] = s.model.WordPrior /
+			(s.model.WordPriorSum + float64(s.model.GlobalTopicHist.At(t)))
+		s.smoothingSum += s.smoothingWeights[t]
+	}
+	s.smoothingTable.build(s.smoothingWeights, s.smoothingSum)
+	s.smoothingDraws = 0
+}
+
+// wordProposal returns the sparse part of the word-proposal of token,
+// which is rebuilt if it has been drawn as many times as its size.
+func (s *AliasSampler) wordProposal(token int32) *wordProposal {
+	p := s.words[token]
+	if p == nil {
+		p = &wordProposal{}
+		s.words[token] = p
+	} else if p.draws < p.table.Len() {
+		return p
+	}
+
+	p.topics = p.topics[:0]
+	p.weights = p.weights[:0]
+	if p.index == nil {
+		p.index = make(map[int32]float64)
+	}
+	for t := range p.index {
+		delete(p.index, t)
+	}
+	p.sum = 0
+	// Sort topics, so the table does not depend on the iteration order
+	// of the histogram, and Gibbs sampling is reproducible.
+	h := s.model.WordTopicHist(token)
+	h.ForEach(func(t int, c int64) error {
+		if c != 0 {
+			p.topics = append(p.topics, int32(t))
+		}
+		return nil
+	})
+	sort.Sort(int32s(p.topics))
+	for _, t := range p.topics {
+		w := float64(h.At(int(t))) /
+			(s.model.WordPriorSum + float64(s.model.GlobalTopicHist.At(int(t))))
+		p.weights = append(p.weights, w)
+		p.index[t] = w
+		p.sum += w
+	}
+	if p.sum > 0 {
+		p.table.build(p.weights, p.sum)
+	} else {
+		p.table.build(nil, 1)
+	}
+	p.draws = 0
+	return p
+}
+
+// proposeByWord draws a topic from the word-proposal of token.
+func (s *AliasSampler) proposeByWord(p *wordProposal, rng *rand.Rand) int32 {
+	if rng.Float64()*(p.sum+s.smoothingSum) < p.sum {
+		p.draws++
+		return p.topics[p.table.sample(rng)]
+	}
+	if s.smoothingDraws >= s.smoothingTable.Len() {
+		s.buildSmoothingTable()
+	}
+	s.smoothingDraws++
+	return int32(s.smoothingTable.sample(rng))
+}
+
+// proposeByDoc draws a topic from the doc-proposal.  It requires that
+// doc.Topics contains the current topic of the token being sampled.
+func (s *AliasSampler) proposeByDoc(doc *Document, rng *rand.Rand) int32 {
+	l := float64(doc.Len())
+	if rng.Float64()*(l+s.model.TopicPriorSum) < l {
+		return doc.Topics[rng.Intn(doc.Len())]
+	}
+	return int32(s.priorTable.sample(rng))
+}
+
+// wordProposalWeight returns the unnormalized q_w(k).
+func (s *AliasSampler) wordProposalWeight(p *wordProposal, k int32) float64 {
+	return p.index[k] + s.smoothingWeights[k]
+}
+
+// exclusive returns n_kw+b and n_k+bV, both exclude the token, whose
+// topic is old, being sampled.
+func (s *AliasSampler) exclusive(h hist.Hist, k, old int32) (
+	float64, float64) {
+	nkw := h.At(int(k))
+	nk := s.model.GlobalTopicHist.At(int(k))
+	if k == old {
+		nkw--
+		nk--
+	}
+	return float64(nkw) + s.model.WordPrior,
+		float64(nk) + s.model.WordPriorSum
+}
+
+// target returns the unnormalized p(k).
+func (s *AliasSampler) target(h hist.Hist, k, old int32) float64 {
+	ndk := s.docTopicCounts[k]
+	if k == old {
+		ndk--
+	}
+	nkw, nk := s.exclusive(h, k, old)
+	return (float64(ndk) + s.model.TopicPrior[k]) * nkw / nk
+}
+
+func (s *AliasSampler) Sample(doc *Document, rng *rand.Rand) {
+	for i := 0; i < doc.TopicHist.Len(); i++ {
+		s.docTopicCounts[doc.TopicHist.Topics[i]] = int32(doc.TopicHist.Counts[i])
+	}
+
+	for i := 0; i < doc.Len(); i++ {
+		token := doc.Words[i]
+		old := doc.Topics[i]
+		h := s.model.WordTopicHist(token)
+		p := s.wordProposal(token)
+
+		cur := old
+		for step := 0; step < s.MHSteps; step++ {
+			// Word-proposal
+			if t := s.proposeByWord(p, rng); t != cur {
+				accept := s.target(h, t, old) * s.wordProposalWeight(p, cur) /
+					(s.target(h, cur, old) * s.wordProposalWeight(p, t))
+				if accept >= 1 || rng.Float64() < accept {
+					cur = t
+					doc.Topics[i] = cur
+				}
+			}
+
+			// Doc-proposal
+			if t := s.proposeByDoc(doc, rng); t != cur {
+				tw, tk := s.exclusive(h, t, old)
+				cw, ck := s.exclusive(h, cur, old)
+				accept := tw * ck / (cw * tk)
+				if accept >= 1 || rng.Float64() < accept {
+					cur = t
+					doc.Topics[i] = cur
+				}
+			}
+		}
+
+		if cur != old {
+			s.moveToken(doc, token, old, cur)
+		}
+	}
+
+	for i := 0; i < doc.TopicHist.Len(); i++ {
+		s.docTopicCounts[doc.TopicHist.Topics[i]] = 0
+	}
+}
+
+// moveToken reassigns a token of doc from topic old to topic cur.
+func (s *AliasSampler) moveToken(doc *Document, token, old, cur int32) {
+	s.model.WordTopicHist(token).Dec(int(old), 1)
+	s.model.GlobalTopicHist.Dec(int(old), 1)
+	doc.TopicHist.Dec(int(old), 1)
+	s.docTopicCounts[old]--
+
+	s.model.WordTopicHist(token).Inc(int(cur), 1)
+	s.model.GlobalTopicHist.Inc(int(cur), 1)
+	doc.TopicHist.Inc(int(cur), 1)
+	s.docTopicCounts[cur]++
+
+	if s.diff != nil {
+		s.diff.WordTopicHist(token).Dec(int(old), 1)
+		s.diff.GlobalTopicHist.Dec(int(old), 1)
+		s.diff.WordTopicHist(token).Inc(int(cur), 1)
+		s.diff.GlobalTopicHist.Inc(int(cur), 1)
+	}
+}
+
+type int32s []int32
+
+func (a int32s) Len() int           { return len(a) }
+func (a int32s) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a int32s) Less(i, j int) bool { return a[i] < a[j] }
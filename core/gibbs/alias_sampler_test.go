@@ -0,0 +1,90 @@
+package gibbs
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func createTestingCorpus(v *Vocabulary, rng *rand.Rand) []*Document {
+	return []*Document{
+		InitializeDocument([]string{"apple", "orange"}, v, testingK, rng),
+		InitializeDocument([]string{"orange", "apple"}, v, testingK, rng),
+		InitializeDocument([]string{"cat", "tiger"}, v, testingK, rng),
+		InitializeDocument([]string{"tiger", "cat"}, v, testingK, rng),
+	}
+}
+
+func TestAliasSamplerSample(t *testing.T) {
+	v, e := CreateTestingVocabulary()
+	if e != nil {
+		t.Fatalf("Failed building testing vocabulary")
+	}
+
+	rng := rand.New(rand.NewSource(-1))
+	corpus := createTestingCorpus(v, rng)
+	m := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	for _, d := range corpus {
+		d.ApplyToModel(m)
+	}
+
+	s := NewAliasSampler(m)
+	for iter := 0; iter < testingTotalIterations; iter++ {
+		for _, d := range corpus {
+			s.Sample(d, rng)
+		}
+	}
+
+	// The model should group {apple, orange} and {cat, tiger}.
+	topicOf := func(word string) int {
+		h := m.WordTopicHists[v.Id(word)]
+		if h.Len() != 1 {
+			t.Fatalf("Expecting %s in one topic, got %v", word, h)
+		}
+		topic := -1
+		h.ForEach(func(t int, _ int64) error {
+			topic = t
+			return nil
+		})
+		return topic
+	}
+	if topicOf("apple") != topicOf("orange") ||
+		topicOf("cat") != topicOf("tiger") ||
+		topicOf("apple") == topicOf("cat") {
+		t.Errorf("Unexpected model %v", m.WordTopicHists)
+	}
+	if m.GlobalTopicHist.At(0) != 4 || m.GlobalTopicHist.At(1) != 4 {
+		t.Errorf("Unexpected global topic histogram %v", m.GlobalTopicHist)
+	}
+}
+
+func TestAliasSamplerDiff(t *testing.T) {
+	v, e := CreateTestingVocabulary()
+	if e != nil {
+		t.Fatalf("Failed building testing vocabulary")
+	}
+
+	rng := rand.New(rand.NewSource(-1))
+	corpus := createTestingCorpus(v, rng)
+	m := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	d := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	for _, doc := range corpus {
+		doc.ApplyToModel(m)
+		doc.ApplyToModel(d)
+	}
+
+	s := NewAliasSampler(m)
+	s.SetDiff(d)
+	for iter := 0; iter < testingTotalIterations; iter++ {
+		for _, d := range corpus {
+			s.Sample(d, rng)
+		}
+	}
+
+	if sprint(*m) != sprint(*d) {
+		t.Errorf("model does not equal to diff. Model:\n%v\nDiff:\n%v", *m, *d)
+	}
+}
+
+func BenchmarkAliasSamplerSampleLargeK(b *testing.B) {
+	benchmarkKernelLargeK(b, AliasKernel)
+}
@@ -0,0 +1,35 @@
+package gibbs
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAliasTable(t *testing.T) {
+	const N = 100000
+	weights := []float64{1, 0, 3, 6}
+	var a aliasTable
+	a.build(weights, 10)
+	if a.Len() != len(weights) {
+		t.Fatalf("Expecting a.Len() = %d, got %d", len(weights), a.Len())
+	}
+
+	rng := rand.New(rand.NewSource(-1))
+	counts := make([]int, len(weights))
+	for i := 0; i < N; i++ {
+		counts[a.sample(rng)]++
+	}
+	for i, w := range weights {
+		if f := float64(counts[i]) / N; math.Abs(f-w/10) > 0.01 {
+			t.Errorf("Expecting frequency of %d close to %f, got %f",
+				i, w/10, f)
+		}
+	}
+
+	// Rebuild reuses slices.
+	a.build([]float64{2, 2}, 4)
+	if a.Len() != 2 {
+		t.Errorf("Expecting a.Len() = 2, got %d", a.Len())
+	}
+}
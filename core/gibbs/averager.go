@@ -0,0 +1,149 @@
+package gibbs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+)
+
+// Averager accumulates Gibbs samples of a model and computes the
+// averaged word-topic distributions P(w|z) and topic priors, which
+// are less noisy than those of a single sample.
+//
+// P(w|z) of a sample is (n_kw+b)/(n_k+bV), which can be decomposed
+// into a sparse part n_kw/(n_k+bV) and a smoothing part b/(n_k+bV).
+// Averager sums up both parts separately, so Add takes O(#non-zeros+K)
+// time and memory is proportional to the number of non-zeros.
+type Averager struct {
+	wordTopicSums  []map[int32]float64 // sums of n_kw/(n_k+bV)
+	smoothingSums  []float64           // sums of b/(n_k+bV)
+	topicPriorSums []float64
+	wordPriorSum   float64 // sum of b, for averaging b
+	samples        int
+}
+
+func NewAverager(numTopics, vocabSize int) *Averager {
+	return &Averager{
+		wordTopicSums:  make([]map[int32]float64, vocabSize),
+		smoothingSums:  make([]float64, numTopics),
+		topicPriorSums: make([]float64, numTopics),
+	}
+}
+
+// Samples returns the number of samples added.
+func (a *Averager) Samples() int {
+	return a.samples
+}
+
+// Add accumulates model m as a sample.
+func (a *Averager) Add(m *Model) {
+	if m.NumTopics() != len(a.smoothingSums) ||
+		m.VocabSize() != len(a.wordTopicSums) {
+		panic(fmt.Sprintf("Model (%d topics, %d tokens) mismatches "+
+			"Averager (%d topics, %d tokens)", m.NumTopics(), m.VocabSize(),
+			len(a.smoothingSums), len(a.wordTopicSums)))
+	}
+
+	for t := range a.smoothingSums {
+		a.smoothingSums[t] += m.WordPrior /
+			(m.WordPriorSum + float64(m.GlobalTopicHist.At(t)))
+		a.topicPriorSums[t] += m.TopicPrior[t]
+	}
+	for w, h := range m.WordTopicHists {
+		if h == nil {
+			continue
+		}
+		h.ForEach(func(t int, c int64) error {
+			if c != 0 {
+				if a.wordTopicSums[w] == nil {
+					a.wordTopicSums[w] = make(map[int32]float64)
+				}
+				a.wordTopicSums[w][int32(t)] += float64(c) /
+					(m.WordPriorSum + float64(m.GlobalTopicHist.At(t)))
+			}
+			return nil
+		})
+	}
+	a.wordPriorSum += m.WordPrior
+	a.samples++
+}
+
+// Model returns the averaged model.  As Hist supports only integer
+// counts, fractional counts are represented in fixed-point: counts
+// and the word prior are scaled by resolution, which keeps P(w|z)
+// unchanged, so the returned model can be consumed by Interpreter and
+// Evaluator like any other model.  With a single sample, counts of
+// the returned model are exactly resolution times original counts.
+// The returned model is for serving, and should not be trained
+// further.
+//
+// Given the averaged P(w|z), denoted by p_kw, and the averaged
+// smoothing part m_k, we set the word prior to b'=resolution*b and
+// n'_k+b'V to b'/m_k, and we get
+/*
+   n'_kw = p_kw b'/m_k - b' = b' (sum of n_kw/(n_k+bV)) / (sum of b/(n_k+bV))
+*/
+func (a *Averager) Model(resolution float64) (*Model, error) {
+	if a.samples <= 0 {
+		return nil, fmt.Errorf("Averager has no sample")
+	}
+	if resolution <= 0 {
+		return nil, fmt.Errorf("resolution (%f) <= 0", resolution)
+	}
+
+	n := float64(a.samples)
+	b := resolution * a.wordPriorSum / n
+	m := NewModel(len(a.smoothingSums), len(a.wordTopicSums), 1.0, b)
+	m.TopicPriorSum = 0
+	for t := range m.TopicPrior {
+		m.TopicPrior[t] = a.topicPriorSums[t] / n
+		m.TopicPriorSum += m.TopicPrior[t]
+	}
+
+	for w, sums := range a.wordTopicSums {
+		for t, s := range sums {
+			c := math.Floor(b*s/a.smoothingSums[t] + 0.5)
+			if c >= math.MaxInt64 {
+				return nil, fmt.Errorf(
+					"Count of word %d in topic %d overflows, "+
+						"try a smaller resolution than %f", w, t, resolution)
+			}
+			if c > 0 {
+				m.WordTopicHist(int32(w)).Inc(int(t), int(c))
+				m.GlobalTopicHist.Inc(int(t), int(c))
+			}
+		}
+	}
+	return m, nil
+}
+
+// averagerGob mirrors Averager with exported fields for gob.
+type averagerGob struct {
+	WordTopicSums  []map[int32]float64
+	SmoothingSums  []float64
+	TopicPriorSums []float64
+	WordPriorSum   float64
+	Samples        int
+}
+
+// GobEncode allows Averager to be saved into checkpoints.
+func (a *Averager) GobEncode() ([]byte, error) {
+	var b bytes.Buffer
+	e := gob.NewEncoder(&b).Encode(&averagerGob{a.wordTopicSums,
+		a.smoothingSums, a.topicPriorSums, a.wordPriorSum, a.samples})
+	return b.Bytes(), e
+}
+
+func (a *Averager) GobDecode(data []byte) error {
+	var g averagerGob
+	if e := gob.NewDecoder(bytes.NewReader(data)).Decode(&g); e != nil {
+		return e
+	}
+	a.wordTopicSums = g.WordTopicSums
+	a.smoothingSums = g.SmoothingSums
+	a.topicPriorSums = g.TopicPriorSums
+	a.wordPriorSum = g.WordPriorSum
+	a.samples = g.Samples
+	return nil
+}
@@ -0,0 +1,102 @@
+package gibbs
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAveragerSingleSample(t *testing.T) {
+	m := CreateTestingModel()
+	a := NewAverager(testingK, testingV)
+	a.Add(m)
+	r, e := a.Model(10)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	for w, h := range m.WordTopicHists {
+		for k := 0; k < testingK; k++ {
+			var c int64
+			if h != nil {
+				c = h.At(k)
+			}
+			if rc := r.WordTopicHist(int32(w)).At(k); rc != 10*c {
+				t.Errorf("Word %d topic %d: expecting %d, got %d",
+					w, k, 10*c, rc)
+			}
+		}
+	}
+	if r.WordPrior != 10*m.WordPrior {
+		t.Errorf("Expecting word prior %f, got %f", 10*m.WordPrior, r.WordPrior)
+	}
+}
+
+func TestAveragerModel(t *testing.T) {
+	v, e := CreateTestingVocabulary()
+	if e != nil {
+		t.Fatalf("Failed building testing vocabulary")
+	}
+
+	rng := rand.New(rand.NewSource(-1))
+	corpus := createTestingCorpus(v, rng)
+	m := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	for _, d := range corpus {
+		d.ApplyToModel(m)
+	}
+
+	// Average P(w|z) explicitly along with an Averager.
+	truth := make([]float64, testingK*testingV)
+	a := NewAverager(testingK, testingV)
+	s := NewSampler(m)
+	const samples = 20
+	for iter := 0; iter < samples; iter++ {
+		for _, d := range corpus {
+			s.Sample(d, rng)
+		}
+		a.Add(m)
+		accessor := NewModelAccessor(m, 0)
+		for w := 0; w < testingV; w++ {
+			for k := 0; k < testingK; k++ {
+				truth[w*testingK+k] +=
+					accessor.WordTopicProb(int32(w), k) / samples
+			}
+		}
+	}
+
+	r, e := a.Model(1e6)
+	if e != nil {
+		t.Fatal(e)
+	}
+	accessor := NewModelAccessor(r, 0)
+	for w := 0; w < testingV; w++ {
+		for k := 0; k < testingK; k++ {
+			p := accessor.WordTopicProb(int32(w), k)
+			if math.Abs(p-truth[w*testingK+k]) > 1e-6 {
+				t.Errorf("Word %d topic %d: expecting %f, got %f",
+					w, k, truth[w*testingK+k], p)
+			}
+		}
+	}
+}
+
+func TestAveragerNoSample(t *testing.T) {
+	if _, e := NewAverager(testingK, testingV).Model(1); e == nil {
+		t.Errorf("Expecting error for no sample")
+	}
+}
+
+func TestAveragerLargeCounts(t *testing.T) {
+	a := NewAverager(testingK, testingV)
+	a.Add(CreateTestingModel())
+	r, e := a.Model(5e9)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if c := r.WordTopicHist(1).At(1); c != 5e9 {
+		t.Errorf("Expecting count %d, got %d", int64(5e9), c)
+	}
+	if _, e := a.Model(1e19); e == nil {
+		t.Errorf("Expecting error for counts overflowing int64")
+	}
+}
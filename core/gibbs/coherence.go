@@ -0,0 +1,131 @@
+package gibbs
+
+import (
+	"math"
+)
+
+// TopicCoherence contains coherence scores of the top words of a
+// topic, computed from document co-occurrence counts in a reference
+// corpus.  UMass is proposed in *Optimizing Semantic Coherence in
+// Topic Models* by David Mimno et al. at EMNLP in 2011:
+/*
+   UMass = mean_{i<j} log (D(w_i, w_j) + 1) / D(w_i)
+*/
+// where w_i ranks higher than w_j, and pairs with D(w_i) = 0 are
+// ignored.  NPMI is normalized pointwise mutual information:
+/*
+   NPMI = mean_{i<j} log (P(w_i, w_j) / P(w_i) P(w_j)) / -log P(w_i, w_j)
+*/
+// where probabilities are document frequencies divided by the number
+// of documents, and a pair that never co-occurs scores -1.  Both are
+// means over pairs, so they are comparable across different numbers
+// of top words.  Higher scores mean more coherent topics.
+type TopicCoherence struct {
+	Topic int
+	Words []int32 // top words in descending order of counts
+	UMass float64
+	NPMI  float64
+}
+
+// ComputeCoherence computes coherence of the topN words returned by
+// TopicIndex.TopWords of every non-empty topic, using documents in
+// corpus as reference.
+func ComputeCoherence(m *Model, corpus []*Document, topN int) []*TopicCoherence {
+	cs := make([]*TopicCoherence, 0, m.NumTopics())
+	interest := make(map[int32]int) // word -> document frequency
+	pairs := make(map[[2]int32]int) // word pair -> co-document frequency
+	x := NewTopicIndex(m)
+	for t := 0; t < m.NumTopics(); t++ {
+		o := x.TopWords(t)
+		if o == nil {
+			continue
+		}
+		n := o.Len()
+		if n > topN {
+			n = topN
+		}
+		c := &TopicCoherence{Topic: t, Words: make([]int32, n)}
+		copy(c.Words, o.Topics[:n])
+		for i, wi := range c.Words {
+			interest[wi] = 0
+			for _, wj := range c.Words[i+1:] {
+				pairs[orderedPair(wi, wj)] = 0
+			}
+		}
+		cs = append(cs, c)
+	}
+
+	present := make([]int32, 0)
+	seen := make(map[int32]bool)
+	for _, d := range corpus {
+		present = present[:0]
+		for _, w := range d.Words {
+			if _, ok := interest[w]; ok && !seen[w] {
+				seen[w] = true
+				present = append(present, w)
+			}
+		}
+		for i, wi := range present {
+			interest[wi]++
+			delete(seen, wi)
+			for _, wj := range present[i+1:] {
+				p := orderedPair(wi, wj)
+				if _, ok := pairs[p]; ok {
+					pairs[p]++
+				}
+			}
+		}
+	}
+
+	D := float64(len(corpus))
+	for _, c := range cs {
+		var umass, npmi float64
+		var numUMass, numNPMI int
+		for i, wi := range c.Words {
+			for _, wj := range c.Words[i+1:] {
+				co := float64(pairs[orderedPair(wi, wj)])
+				di, dj := float64(interest[wi]), float64(interest[wj])
+				if di > 0 {
+					umass += math.Log((co + 1) / di)
+					numUMass++
+				}
+				switch {
+				case co <= 0:
+					npmi += -1
+				case co >= D:
+					npmi += 1
+				default:
+					pij := co / D
+					npmi += math.Log(pij/(di/D)/(dj/D)) / -math.Log(pij)
+				}
+				numNPMI++
+			}
+		}
+		if numUMass > 0 {
+			c.UMass = umass / float64(numUMass)
+		}
+		if numNPMI > 0 {
+			c.NPMI = npmi / float64(numNPMI)
+		}
+	}
+	return cs
+}
+
+// MeanCoherence returns the mean UMass and NPMI scores of topics.
+func MeanCoherence(cs []*TopicCoherence) (umass, npmi float64) {
+	if len(cs) <= 0 {
+		return 0, 0
+	}
+	for _, c := range cs {
+		umass += c.UMass
+		npmi += c.NPMI
+	}
+	return umass / float64(len(cs)), npmi / float64(len(cs))
+}
+
+func orderedPair(a, b int32) [2]int32 {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int32{a, b}
+}
@@ -0,0 +1,40 @@
+package gibbs
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestComputeCoherence(t *testing.T) {
+	m := CreateTestingModel() // Topic 1 has orange (1) and apple (3).
+	corpus := []*Document{
+		{Words: []int32{1, 3}},
+		{Words: []int32{1}},
+		{Words: []int32{0, 2}},
+		{Words: []int32{3, 1, 1}}}
+
+	cs := ComputeCoherence(m, corpus, 10)
+	if len(cs) != 1 || cs[0].Topic != 1 ||
+		!reflect.DeepEqual(cs[0].Words, []int32{1, 3}) {
+		t.Fatalf("Expecting topic 1 with words [1 3], got %v", cs)
+	}
+	// D(orange) = 3, D(apple) = 2, D(orange, apple) = 2, D = 4.
+	umass := math.Log((2.0 + 1) / 3)
+	npmi := math.Log(0.5/(0.75*0.5)) / -math.Log(0.5)
+	if math.Abs(cs[0].UMass-umass) > 1e-9 || math.Abs(cs[0].NPMI-npmi) > 1e-9 {
+		t.Errorf("Expecting UMass %f NPMI %f, got %f %f",
+			umass, npmi, cs[0].UMass, cs[0].NPMI)
+	}
+
+	if u, n := MeanCoherence(cs); u != cs[0].UMass || n != cs[0].NPMI {
+		t.Errorf("Expecting mean %f %f, got %f %f",
+			cs[0].UMass, cs[0].NPMI, u, n)
+	}
+
+	// Words that never co-occur score -1 in NPMI.
+	cs = ComputeCoherence(m, corpus[1:3], 10)
+	if cs[0].NPMI != -1 {
+		t.Errorf("Expecting NPMI -1, got %f", cs[0].NPMI)
+	}
+}
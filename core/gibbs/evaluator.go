@@ -73,29 +73,46 @@ func NewEvaluator(model *Model, cacheSizeMB int, s *Sampler) *Evaluator {
 
 func calculateEvaluationCoeff(model *ModelAccessor, s *Sampler) []float64 {
 	coeff := make([]float64, len(model.WordTopicHists))
-	// TODO(yi): Parallellize the following loop.
-	for token, _ := range model.WordTopicHists {
-		if hist := model.WordTopicHists[token]; hist != nil {
-			if s != nil {
-				hist.ForEach(func(topic int, count int64) error {
-					coeff[token] +=
-						model.TopicPrior[topic] * float64(count) /
-							(model.WordPrior +
-								float64(model.GlobalTopicHist.At(topic)))
-					return nil
-				})
-				coeff[token] += s.smoothingOnlyBucketSize
-			} else {
-				dist := model.WordTopicDist(int32(token))
-				for j, _ := range dist {
-					coeff[token] += dist[j] * model.TopicPrior[j]
-				}
+	var smoothingOnly, wordPrior float64
+	if s == nil {
+		smoothingOnly = smoothingOnlyBucketSize(model)
+		wordPrior = model.WordPriorSum
+	} else {
+		smoothingOnly = s.smoothingOnlyBucketSize
+		wordPrior = model.WordPrior
+	}
+	parallelRanges(len(coeff), func(begin, end int) {
+		var topics []int32
+		var counts []int64
+		for token := begin; token < end; token++ {
+			hist := model.WordTopicHists[token]
+			if hist == nil {
+				continue
+			}
+			topics, counts = hist.AppendNonZeros(topics[:0], counts[:0])
+			for i, topic := range topics {
+				coeff[token] +=
+					model.TopicPrior[topic] * float64(counts[i]) /
+						(wordPrior + float64(model.GlobalTopicHist.At(int(topic))))
 			}
+			coeff[token] += smoothingOnly
 		}
-	}
+	})
 	return coeff
 }
 
+// smoothingOnlyBucketSize computes s as Sampler.smoothingOnlyBucketSize
+// does, so that calculateEvaluationCoeff can be O(#non-zeros) per token
+// even without a Sampler.
+func smoothingOnlyBucketSize(model *ModelAccessor) float64 {
+	var s float64
+	for t := 0; t < model.NumTopics(); t++ {
+		s += model.TopicPrior[t] * model.WordPrior /
+			(model.WordPriorSum + float64(model.GlobalTopicHist.At(t)))
+	}
+	return s
+}
+
 // Perplexity computes log-likelihood of a document. It returns
 // log-likelihood as well as the document length, which, when divided,
 // get to the perplexity of the document, or when aggregated along
@@ -106,15 +123,14 @@ func (e *Evaluator) Perplexity(doc *Document) (float64, int) {
 	}
 
 	logl := 0.0
-	cache := newDistCache(e.model)
 	for i := 0; i < doc.Len(); i++ {
-		wordTopicDist := cache.Get(doc.Words[i])
+		word := doc.Words[i]
 		prob := 0.0
-		doc.TopicHist.ForEach(func(topic int, count int64) error {
-			prob += wordTopicDist[topic] * float64(count)
-			return nil
-		})
-		logl += math.Log((e.cachedCoeff[doc.Words[i]] + prob) /
+		for j, topic := range doc.TopicHist.Topics {
+			prob += e.model.WordTopicProb(word, int(topic)) *
+				float64(doc.TopicHist.Counts[j])
+		}
+		logl += math.Log((e.cachedCoeff[word] + prob) /
 			(float64(doc.Len()) + e.model.TopicPriorSum))
 	}
 	return logl, doc.Len()
@@ -27,3 +27,26 @@ func TestEvaluatorPerplexityAccel(t *testing.T) {
 		t.Errorf("Expecting %s, got %s", truth, s)
 	}
 }
+
+func BenchmarkEvaluatorLargeK(b *testing.B) {
+	m, corpus := createLargeKCorpus()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ev := NewEvaluator(m, 0, nil)
+		for _, d := range corpus {
+			ev.Perplexity(d)
+		}
+	}
+}
+
+// BenchmarkNewEvaluatorLargeK measures the cost of creating an
+// Evaluator, which trainers pay at every evaluation iteration.
+func BenchmarkNewEvaluatorLargeK(b *testing.B) {
+	m, _ := createLargeKCorpus()
+	s := NewSampler(m)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewEvaluator(m, 100, s)
+	}
+}
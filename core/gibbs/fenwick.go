@@ -0,0 +1,58 @@
+package gibbs
+
+// fenwickTree, a.k.a. binary indexed tree, maintains prefix sums of
+// non-negative weights, so both updating a weight and locating a draw
+// in the cumulative distribution take O(log n) time.  Sampler uses it
+// to sample from the smoothing-only bucket, which has as many
+// elements as topics.
+type fenwickTree struct {
+	sums []float64 // 1-based
+	mask int       // the largest power of 2 not larger than n
+}
+
+func (f *fenwickTree) Len() int {
+	return len(f.sums) - 1
+}
+
+// build makes the tree represent weights in O(n) time.
+func (f *fenwickTree) build(weights []float64) {
+	n := len(weights)
+	if cap(f.sums) < n+1 {
+		f.sums = make([]float64, n+1)
+	}
+	f.sums = f.sums[:n+1]
+	f.sums[0] = 0
+	copy(f.sums[1:], weights)
+	for i := 1; i <= n; i++ {
+		if j := i + (i & -i); j <= n {
+			f.sums[j] += f.sums[i]
+		}
+	}
+	for f.mask = 1; f.mask*2 <= n; f.mask *= 2 {
+	}
+}
+
+// add adds delta to the i-th weight, where i is 0-based.
+func (f *fenwickTree) add(i int, delta float64) {
+	for i++; i < len(f.sums); i += i & -i {
+		f.sums[i] += delta
+	}
+}
+
+// search returns the smallest 0-based index i, such that the sum of
+// weights 0 to i is larger than or equal to draw.  If draw is larger
+// than the total weight due to rounding errors, it returns the last
+// index.
+func (f *fenwickTree) search(draw float64) int {
+	pos := 0
+	for m := f.mask; m > 0; m /= 2 {
+		if pos+m < len(f.sums) && f.sums[pos+m] < draw {
+			pos += m
+			draw -= f.sums[pos]
+		}
+	}
+	if pos >= f.Len() {
+		pos = f.Len() - 1
+	}
+	return pos
+}
@@ -0,0 +1,34 @@
+package gibbs
+
+import (
+	"testing"
+)
+
+func TestFenwickTree(t *testing.T) {
+	weights := []float64{0.5, 1, 0.25, 2, 0.25}
+	var f fenwickTree
+	f.build(weights)
+	if f.Len() != len(weights) {
+		t.Fatalf("Expecting f.Len() = %d, got %d", len(weights), f.Len())
+	}
+
+	type testCase struct {
+		draw  float64
+		index int
+	}
+	for _, c := range []testCase{
+		{0.1, 0}, {0.5, 0}, {0.6, 1}, {1.5, 1}, {1.6, 2}, {1.75, 2},
+		{3.0, 3}, {3.75, 3}, {3.9, 4}, {4.0, 4}, {5.0, 4}} {
+		if i := f.search(c.draw); i != c.index {
+			t.Errorf("search(%f): expecting %d, got %d", c.draw, c.index, i)
+		}
+	}
+
+	f.add(0, 1.5) // weights = {2, 1, 0.25, 2, 0.25}
+	for _, c := range []testCase{
+		{1.9, 0}, {2.0, 0}, {2.1, 1}, {3.2, 2}, {5.0, 3}} {
+		if i := f.search(c.draw); i != c.index {
+			t.Errorf("search(%f): expecting %d, got %d", c.draw, c.index, i)
+		}
+	}
+}
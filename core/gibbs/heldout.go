@@ -0,0 +1,168 @@
+package gibbs
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	DocumentCompletion = "completion"
+	LeftToRight        = "left-to-right"
+)
+
+// HeldOutEvaluator estimates the log-likelihood of documents unseen
+// in training given a fixed model, which, unlike Evaluator, does not
+// use topic assignments of the documents learned in training.  It
+// supports two estimators described in *Evaluation Methods for Topic
+// Models* by Hanna Wallach, Iain Murray, Ruslan Salakhutdinov and
+// David Mimno at ICML in 2009:
+//
+// DocumentCompletion samples topics of the first half of a document
+// to estimate its topic distribution, and computes the likelihood of
+// the second half.
+//
+// LeftToRight computes the likelihood of every word given words to
+// its left, using Particles particles, each of which resamples topics
+// of words to the left.  It costs O(L^2 K) for a document of length
+// L, so it is suitable for evaluation on small held-out corpora.
+//
+// Both estimators sample topics in O(K) per word.  It is safe to call
+// Perplexity from multiple goroutines.
+type HeldOutEvaluator struct {
+	model      *ModelAccessor
+	method     string
+	Particles  int // used by LeftToRight
+	Iterations int // used by DocumentCompletion
+}
+
+func NewHeldOutEvaluator(model *Model, method string, cacheSizeMB int) (
+	*HeldOutEvaluator, error) {
+	if method != DocumentCompletion && method != LeftToRight {
+		return nil, fmt.Errorf("Unknown held-out method %s, expecting %s or %s",
+			method, DocumentCompletion, LeftToRight)
+	}
+	a := NewModelAccessor(model, cacheSizeMB)
+	return &HeldOutEvaluator{
+		model:      a,
+		method:     method,
+		Particles:  10,
+		Iterations: 20,
+	}, nil
+}
+
+// Perplexity returns the log-likelihood of doc.Words and the number
+// of words whose likelihood are counted, like Evaluator.Perplexity.
+// It does not read or change doc.Topics and doc.TopicHist.
+func (h *HeldOutEvaluator) Perplexity(doc *Document, rng *rand.Rand) (
+	float64, int) {
+	if h.method == LeftToRight {
+		return h.leftToRight(doc.Words, rng)
+	}
+	return h.documentCompletion(doc.Words, rng)
+}
+
+func (h *HeldOutEvaluator) documentCompletion(words []int32,
+	rng *rand.Rand) (float64, int) {
+	observed, heldOut := words[:len(words)/2], words[len(words)/2:]
+	K := h.model.NumTopics()
+	topics := make([]int, len(observed))
+	counts := make([]float64, K)
+	theta := make([]float64, K)
+	probs := make([]float64, K)
+	buf := make([]float64, K)
+
+	for i, w := range observed {
+		topics[i] = h.sampleTopic(w, counts, probs, buf, rng)
+		counts[topics[i]]++
+	}
+	norm := float64(len(observed)) + h.model.TopicPriorSum
+	for iter := 0; iter < h.Iterations; iter++ {
+		for i, w := range observed {
+			counts[topics[i]]--
+			topics[i] = h.sampleTopic(w, counts, probs, buf, rng)
+			counts[topics[i]]++
+		}
+		for k := range theta {
+			theta[k] += (counts[k] + h.model.TopicPrior[k]) / norm
+		}
+	}
+	if h.Iterations <= 0 {
+		for k := range theta {
+			theta[k] = (counts[k] + h.model.TopicPrior[k]) / norm
+		}
+	} else {
+		for k := range theta {
+			theta[k] /= float64(h.Iterations)
+		}
+	}
+
+	logL := 0.0
+	for _, w := range heldOut {
+		dist := h.model.wordTopicDistTo(buf, w)
+		p := 0.0
+		for k, phi := range dist {
+			p += phi * theta[k]
+		}
+		logL += math.Log(p)
+	}
+	return logL, len(heldOut)
+}
+
+func (h *HeldOutEvaluator) leftToRight(words []int32, rng *rand.Rand) (
+	float64, int) {
+	K := h.model.NumTopics()
+	likelihoods := make([]float64, len(words))
+	topics := make([]int, len(words))
+	counts := make([]float64, K)
+	probs := make([]float64, K)
+	buf := make([]float64, K)
+
+	for r := 0; r < h.Particles; r++ {
+		for k := range counts {
+			counts[k] = 0
+		}
+		for n, w := range words {
+			for i := 0; i < n; i++ {
+				counts[topics[i]]--
+				topics[i] = h.sampleTopic(words[i], counts, probs, buf, rng)
+				counts[topics[i]]++
+			}
+
+			dist := h.model.wordTopicDistTo(buf, w)
+			p := 0.0
+			for k, phi := range dist {
+				p += phi * (counts[k] + h.model.TopicPrior[k])
+			}
+			likelihoods[n] += p / (float64(n) + h.model.TopicPriorSum)
+
+			topics[n] = h.sampleTopic(w, counts, probs, buf, rng)
+			counts[topics[n]]++
+		}
+	}
+
+	logL := 0.0
+	for _, l := range likelihoods {
+		logL += math.Log(l / float64(h.Particles))
+	}
+	return logL, len(words)
+}
+
+// sampleTopic samples a topic of word w given topic counts of other
+// words in the document.  probs and buf are buffers of K elements.
+func (h *HeldOutEvaluator) sampleTopic(w int32, counts, probs,
+	buf []float64, rng *rand.Rand) int {
+	dist := h.model.wordTopicDistTo(buf, w)
+	sum := 0.0
+	for k, phi := range dist {
+		sum += phi * (counts[k] + h.model.TopicPrior[k])
+		probs[k] = sum
+	}
+	draw := rng.Float64() * sum
+	for k, p := range probs {
+		if draw < p {
+			return k
+		}
+	}
+	return len(probs) - 1
+}
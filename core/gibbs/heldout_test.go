@@ -0,0 +1,50 @@
+package gibbs
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHeldOutEvaluatorUniformModel(t *testing.T) {
+	// Given an empty model, every word has probability 1/V under every
+	// topic, so the log-likelihood does not depend on sampled topics.
+	m := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	d := &Document{Words: []int32{0, 1, 2, 3, 3}}
+	for method, n := range map[string]int{DocumentCompletion: 3, LeftToRight: 5} {
+		h, e := NewHeldOutEvaluator(m, method, 0)
+		if e != nil {
+			t.Fatal(e)
+		}
+		logL, nw := h.Perplexity(d, rand.New(rand.NewSource(1)))
+		truth := float64(n) * math.Log(1.0/testingV)
+		if nw != n || math.Abs(logL-truth) > 1e-9 {
+			t.Errorf("%s: expecting %f over %d words, got %f over %d",
+				method, truth, n, logL, nw)
+		}
+	}
+}
+
+func TestHeldOutEvaluator(t *testing.T) {
+	m, _, e := CreateTestingOptimizedModel()
+	if e != nil {
+		t.Fatal(e)
+	}
+	d := &Document{Words: []int32{1, 3, 1, 3, 1, 3}}
+	for _, method := range []string{DocumentCompletion, LeftToRight} {
+		h, e := NewHeldOutEvaluator(m, method, -1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		l1, _ := h.Perplexity(d, rand.New(rand.NewSource(1)))
+		l2, _ := h.Perplexity(d, rand.New(rand.NewSource(1)))
+		if l1 != l2 || l1 >= 0 || math.IsNaN(l1) {
+			t.Errorf("%s: expecting deterministic negative log-likelihood, "+
+				"got %f and %f", method, l1, l2)
+		}
+	}
+
+	if _, e := NewHeldOutEvaluator(m, "unknown", 0); e == nil {
+		t.Errorf("Expecting error for unknown method")
+	}
+}
@@ -3,9 +3,12 @@ package gibbs
 import (
 	"errors"
 	"fmt"
+	"github.com/wangkuiyi/parallel"
 	"github.com/wangkuiyi/phoenix/core/hist"
 	"hash/fnv"
+	"math"
 	"math/rand"
+	"runtime"
 	"sort"
 	"strings"
 )
@@ -14,49 +17,158 @@ const (
 	ErrEmptyDoc = "Interpret empty document."
 )
 
+// Interpreter infers the topic distribution of a document given a
+// model.  The smoothing-only bucket of a word w, a_k (n_kw+b)/(n_k+bV),
+// is decomposed into a part shared by all words, a_k b/(n_k+bV), and
+// a sparse part a_k n_kw/(n_k+bV), so the cost of sampling does not
+// grow linearly with the number of topics.
 type Interpreter struct {
 	model            *ModelAccessor
 	vocab            *Vocabulary
 	smoothingOnlySum []float64
+
+	// smoothingOnlyCumsum[k] = \sum_{j<=k} a_j b/(n_j+bV)
+	smoothingOnlyCumsum []float64
+
+	// Used by InterpretVariational: smoothingOnlyProb[k] = b/(n_k+bV),
+	// and with q_k = a_k b/(n_k+bV) / \sum_j a_j b/(n_j+bV),
+	// smoothingOnlyMoment = \sum_k q_k b/(n_k+bV) and
+	// smoothingOnlyMaxShare = max_k q_k.
+	smoothingOnlyProb     []float64
+	smoothingOnlyMoment   float64
+	smoothingOnlyMaxShare float64
 }
 
 func NewInterpreter(m *Model, v *Vocabulary, cacheMB int) *Interpreter {
+	if v != nil && v.ids == nil {
+		// Vocabulary.Id builds the map lazily, which is not safe in
+		// concurrent calls to Interpret.
+		v.buildIdMap()
+	}
 	accessor := NewModelAccessor(m, cacheMB)
-	return &Interpreter{
-		model:            accessor,
-		vocab:            v,
-		smoothingOnlySum: computeWordTopicPriorSum(accessor)}
+	cumsum := computeSmoothingOnlyCumsum(accessor)
+	intr := &Interpreter{
+		model:               accessor,
+		vocab:               v,
+		smoothingOnlySum:    computeWordTopicPriorSum(accessor, cumsum),
+		smoothingOnlyCumsum: cumsum,
+		smoothingOnlyProb:   make([]float64, accessor.NumTopics())}
+	for k := range intr.smoothingOnlyProb {
+		p := accessor.WordPrior /
+			(accessor.WordPriorSum + float64(accessor.GlobalTopicHist.At(k)))
+		q := intr.smoothingOnlyShare(k)
+		intr.smoothingOnlyProb[k] = p
+		intr.smoothingOnlyMoment += q * p
+		intr.smoothingOnlyMaxShare = math.Max(intr.smoothingOnlyMaxShare, q)
+	}
+	return intr
 }
 
-func computeWordTopicPriorSum(model *ModelAccessor) []float64 {
+// smoothingOnlyShare returns q_k = a_k b/(n_k+bV) / \sum_j a_j b/(n_j+bV).
+func (intr *Interpreter) smoothingOnlyShare(k int) float64 {
+	c := intr.smoothingOnlyCumsum
+	if k == 0 {
+		return c[0] / c[len(c)-1]
+	}
+	return (c[k] - c[k-1]) / c[len(c)-1]
+}
+
+func computeSmoothingOnlyCumsum(model *ModelAccessor) []float64 {
+	cumsum := make([]float64, model.NumTopics())
+	var sum float64
+	for topic := range cumsum {
+		sum += model.TopicPrior[topic] * model.WordPrior /
+			(model.WordPriorSum + float64(model.GlobalTopicHist.At(topic)))
+		cumsum[topic] = sum
+	}
+	return cumsum
+}
+
+func computeWordTopicPriorSum(model *ModelAccessor, cumsum []float64) []float64 {
 	smoothingOnlySum := make([]float64, model.VocabSize())
-	for word, _ := range model.WordTopicHists {
-		var sum float64
-		smoothingOnlyBucket := model.WordTopicDist(int32(word))
-		for topic, _ := range smoothingOnlyBucket {
-			sum += model.TopicPrior[topic] * smoothingOnlyBucket[topic]
+	parallelRanges(len(model.WordTopicHists), func(begin, end int) {
+		var topics []int32
+		var counts []int64
+		for word := begin; word < end; word++ {
+			sum := cumsum[len(cumsum)-1]
+			if hist := model.WordTopicHists[word]; hist != nil {
+				topics, counts = hist.AppendNonZeros(topics[:0], counts[:0])
+				for i, topic := range topics {
+					sum += model.TopicPrior[topic] * float64(counts[i]) /
+						(model.WordPriorSum +
+							float64(model.GlobalTopicHist.At(int(topic))))
+				}
+			}
+			smoothingOnlySum[word] = sum
 		}
-		smoothingOnlySum[word] = sum
-	}
+	})
 	return smoothingOnlySum
 }
 
+// Interpret infers the topic distribution of words by iter iterations
+// of Gibbs sampling, where those after burnin are averaged.  The
+// random number stream is seeded by a hash of words, so the result
+// depends only on words.  It returns an error if iter <= burnin.
 func (intr *Interpreter) Interpret(words []string, burnin, iter int) (
 	SparseDist, error) {
+	dist, _, e := intr.interpret(words, burnin, iter, false)
+	return dist, e
+}
+
+// Attribution is the topic attributed to a word of the input.
+type Attribution struct {
+	Word string
+	OOV  bool // out of vocabulary, Topic and Confidence are not set
+
+	// Topic is the most frequently assigned topic of the word in
+	// iterations after burn-in, and Confidence is the fraction of
+	// these iterations assigning Topic.
+	Topic      int32
+	Confidence float64
+}
+
+// InterpretWithAttribution is Interpret, but also returns the topic
+// attributed to each of words, which are in the same order as words.
+// If all words are out of vocabulary, it returns attributions with
+// the error ErrEmptyDoc.  The topic distribution is the same as
+// returned by Interpret.
+func (intr *Interpreter) InterpretWithAttribution(words []string,
+	burnin, iter int) (SparseDist, []Attribution, error) {
+	return intr.interpret(words, burnin, iter, true)
+}
+
+func (intr *Interpreter) interpret(words []string, burnin, iter int,
+	attribute bool) (SparseDist, []Attribution, error) {
 	if iter <= burnin {
-		panic(fmt.Sprintf("iter (%d) <= burin (%d)", iter, burnin))
+		return nil, nil, fmt.Errorf("iter (%d) <= burnin (%d)", iter, burnin)
 	}
 
 	hasher := fnv.New64()
 	hasher.Write([]byte(strings.Join(words, "\t")))
 	rng := rand.New(rand.NewSource(int64(hasher.Sum64())))
 	doc := InitializeDocument(words, intr.vocab, intr.model.NumTopics(), rng)
+
+	var attrs []Attribution
+	var assigned []hist.Sparse // topics assigned to doc.Words after burn-in
+	if attribute {
+		attrs = make([]Attribution, len(words))
+		for i, w := range words {
+			attrs[i].Word = w
+			attrs[i].OOV = intr.vocab.Id(w) < 0
+		}
+		assigned = make([]hist.Sparse, doc.Len())
+		for j := range assigned {
+			assigned[j] = hist.NewSparse()
+		}
+	}
 	if doc.Len() <= 0 {
-		return nil, errors.New(ErrEmptyDoc)
+		return nil, attrs, errors.New(ErrEmptyDoc)
 	}
-	cache := newDistCache(intr.model)
+
+	cache := newWordPriorCache(intr.model)
 	accumulatedTopicHist := hist.NewSparse()
 	norm := 0.0
+	docTopicBucket := make(SparseDist, 0, doc.Len())
 
 	for i := 0; i < iter; i++ {
 		for j := 0; j < doc.Len(); j++ {
@@ -64,17 +176,21 @@ func (intr *Interpreter) Interpret(words []string, burnin, iter int) (
 			oldTopic := doc.Topics[j]
 			doc.TopicHist.Dec(int(oldTopic), 1)
 			smoothingOnlyBucket := cache.Get(word)
-			newTopic := intr.sampleTopic(doc, word, smoothingOnlyBucket, rng)
+			newTopic := intr.sampleTopic(doc, word, smoothingOnlyBucket,
+				docTopicBucket, rng)
 			doc.Topics[j] = newTopic
 			doc.TopicHist.Inc(int(newTopic), 1)
 		}
 
 		if i > burnin {
-			doc.TopicHist.ForEach(func(topic int, count int64) error {
-				accumulatedTopicHist.Inc(topic, int(count))
+			for k, topic := range doc.TopicHist.Topics {
+				count := doc.TopicHist.Counts[k]
+				accumulatedTopicHist.Inc(int(topic), int(count))
 				norm += float64(count)
-				return nil
-			})
+			}
+			for j := range assigned {
+				assigned[j].Inc(int(doc.Topics[j]), 1)
+			}
 		}
 	}
 
@@ -87,34 +203,342 @@ func (intr *Interpreter) Interpret(words []string, burnin, iter int) (
 		return nil
 	})
 	sort.Sort(dist)
+
+	if attribute {
+		j := 0 // doc.Words skips out-of-vocabulary words.
+		for i := range attrs {
+			if !attrs[i].OOV {
+				attrs[i].Topic, attrs[i].Confidence =
+					mostFrequentTopic(assigned[j])
+				j++
+			}
+		}
+	}
+	return dist, attrs, nil
+}
+
+// mostFrequentTopic returns the most frequent topic in h, the smallest
+// one in case of ties, and its fraction.
+func mostFrequentTopic(h hist.Sparse) (int32, float64) {
+	var topic int32 = -1
+	var count, total int64
+	for t, c := range h {
+		if c > count || c == count && t < topic {
+			topic, count = t, c
+		}
+		total += c
+	}
+	return topic, float64(count) / float64(total)
+}
+
+// InterpretVariational infers the topic distribution of words by
+// fixed-point updates of the expected topic counts n_k of the document,
+// a zero-order collapsed variational inference, where each token of a
+// word w contributes gamma_k = P(w|k)(n_k-gamma_k+a_k)/Z_w to n_k.
+// Updates stop when no n_k/L changes by more than tolerance, or after
+// maxIter updates.  Unlike Interpret, it is deterministic, and is
+// usually faster and less noisy for short documents.
+//
+// As in Interpret, P(w|k) is decomposed into a sparse part
+// n_kw/(n_k+bV) and a smoothing-only part b/(n_k+bV).  n_k is
+// decomposed into a sparse part and m q_k, where m is the mass
+// contributed by the smoothing-only part and q_k is proportional to
+// a_k b/(n_k+bV), so an update costs O(non-zero topics of words and the
+// document) instead of O(LK).  The contribution of m q_k through the
+// smoothing-only part, which is proportional to q_k b/(n_k+bV), is
+// approximated in the shape of q_k.  Like Interpret, the returned
+// distribution covers only topics with non-zero sparse parts, so it
+// costs no O(K) time.  The mass m q_k of other topics is omitted, so
+// probabilities sum to slightly less than 1.
+func (intr *Interpreter) InterpretVariational(words []string,
+	tolerance float64, maxIter int) (SparseDist, error) {
+	if tolerance <= 0 {
+		return nil, fmt.Errorf("tolerance (%g) <= 0", tolerance)
+	}
+	if maxIter <= 0 {
+		return nil, fmt.Errorf("maxIter (%d) <= 0", maxIter)
+	}
+
+	var buckets []*wordProbBucket // of distinct words
+	index := make(map[int32]int)
+	length := 0
+	for _, w := range words {
+		id := intr.vocab.Id(w)
+		if id < 0 {
+			continue
+		}
+		i, ok := index[id]
+		if !ok {
+			i = len(buckets)
+			index[id] = i
+			buckets = append(buckets, newWordProbBucket(intr.model, id))
+		}
+		buckets[i].count++
+		length++
+	}
+	if length <= 0 {
+		return nil, errors.New(ErrEmptyDoc)
+	}
+
+	a := intr.model.TopicPrior
+	s := intr.smoothingOnlyProb
+	smoothingOnlySum := intr.smoothingOnlyCumsum[len(a)-1]
+
+	q := intr.smoothingOnlyShare
+	moment := intr.smoothingOnlyMoment
+
+	// n_k = x[pos[k]] + m q_k, where x is aligned with topics.
+	// excluded[i] is x[i] excluding the contribution of a token of the
+	// word being updated.
+	var topics []int32
+	var x, next, excluded []float64
+	var m float64
+	pos := make(map[int32]int)
+	add := func(k int32, v float64) {
+		i, ok := pos[k]
+		if !ok {
+			i = len(topics)
+			pos[k] = i
+			topics = append(topics, k)
+			x, next = append(x, 0), append(next, 0)
+			excluded = append(excluded, 0)
+		}
+		next[i] += v
+	}
+
+	for iter := 0; iter < maxIter; iter++ {
+		var nextM float64
+		for _, b := range buckets {
+			// Exclude a token of the word from n_k.  Its contribution
+			// is solved from gamma_k = f P(w|k)(n_k-gamma_k+a_k),
+			// where f is the normalizer of the last update.
+			f := b.norm
+			mw := math.Max(0,
+				(m-f*smoothingOnlySum)/(1+f*moment))
+			n := len(topics)
+			for i, k := range topics {
+				excluded[i] = x[i] / (1 + f*s[k])
+			}
+			for j, k := range b.topics {
+				if i, ok := pos[k]; ok {
+					r := b.probs[j]
+					excluded[i] = math.Max(0,
+						(x[i]-f*r*(mw*q(int(k))+a[k]))/(1+f*(r+s[k])))
+				}
+			}
+
+			smoothingOnly := smoothingOnlySum + mw*moment
+			z := smoothingOnly
+			for i, k := range topics {
+				z += s[k] * excluded[i]
+			}
+			for j, k := range b.topics {
+				z += b.probs[j] * (b.excludedAt(pos, excluded, j) +
+					mw*q(int(k)) + a[k])
+			}
+
+			b.norm = 1 / z
+			c := float64(b.count) / z
+			for i, k := range topics[:n] {
+				next[i] += c * s[k] * excluded[i]
+			}
+			for j, k := range b.topics {
+				add(k, c*b.probs[j]*(b.excludedAt(pos, excluded[:n], j)+
+					mw*q(int(k))+a[k]))
+			}
+			nextM += c * smoothingOnly
+		}
+
+		dm := nextM - m
+		change := math.Abs(dm) * intr.smoothingOnlyMaxShare
+		for i, k := range topics {
+			d := next[i] - x[i] + dm*q(int(k))
+			change = math.Max(change, math.Abs(d))
+		}
+		x, next, m = next, x, nextM
+		for i := range next {
+			next[i] = 0
+		}
+		if change/float64(length) < tolerance {
+			break
+		}
+	}
+
+	dist := make(SparseDist, len(topics))
+	for i, k := range topics {
+		dist[i].Topic = k
+		dist[i].Prob = (x[i] + m*q(int(k))) / float64(length)
+	}
+	sort.Sort(dist)
 	return dist, nil
 }
 
-type distCache struct {
+// wordProbBucket is the sparse part of P(w|k), n_kw/(n_k+bV), of a
+// word w, with topics in ascending order, the count of w in a
+// document, and the normalizer of the last update of w.
+type wordProbBucket struct {
+	topics []int32
+	probs  []float64
+	count  int
+	norm   float64
+}
+
+// excludedAt returns excluded[pos[b.topics[j]]], or 0 if the topic is
+// not in excluded.
+func (b *wordProbBucket) excludedAt(pos map[int32]int, excluded []float64,
+	j int) float64 {
+	if i, ok := pos[b.topics[j]]; ok && i < len(excluded) {
+		return excluded[i]
+	}
+	return 0
+}
+
+func newWordProbBucket(a *ModelAccessor, word int32) *wordProbBucket {
+	b := &wordProbBucket{}
+	if h := a.WordTopicHists[word]; h != nil {
+		var counts []int64
+		b.topics, counts = h.AppendNonZeros(nil, nil)
+		hist.SortByTopic(b.topics, counts)
+		b.probs = make([]float64, len(b.topics))
+		for i, k := range b.topics {
+			b.probs[i] = float64(counts[i]) /
+				(a.WordPriorSum + float64(a.GlobalTopicHist.At(int(k))))
+		}
+	}
+	return b
+}
+
+// InferenceMethod selects the algorithm used by InterpretWithOptions.
+type InferenceMethod int
+
+const (
+	Gibbs       InferenceMethod = iota // Interpret
+	Variational                        // InterpretVariational
+)
+
+// InterpretOptions are options of InterpretWithOptions and
+// InterpretBatch.
+type InterpretOptions struct {
+	Method InferenceMethod
+
+	// For Gibbs, Iterations is the total number of iterations, which
+	// must be larger than BurnIn, the number of iterations before
+	// averaging.  For Variational, Iterations is the maximum number of
+	// updates, and BurnIn is ignored.
+	BurnIn     int
+	Iterations int
+
+	Tolerance float64 // convergence tolerance of Variational
+	Workers   int     // number of goroutines, GOMAXPROCS if not positive
+}
+
+// DefaultInterpretOptions returns the options used by cmd/interpreter.
+func DefaultInterpretOptions() InterpretOptions {
+	return InterpretOptions{
+		Method:     Gibbs,
+		BurnIn:     50,
+		Iterations: 150,
+		Tolerance:  1e-4}
+}
+
+// InterpretWithOptions interprets words by opts.Method, or returns an
+// error if opts are invalid.
+func (intr *Interpreter) InterpretWithOptions(words []string,
+	opts InterpretOptions) (SparseDist, error) {
+	switch opts.Method {
+	case Gibbs:
+		return intr.Interpret(words, opts.BurnIn, opts.Iterations)
+	case Variational:
+		return intr.InterpretVariational(words, opts.Tolerance,
+			opts.Iterations)
+	}
+	return nil, fmt.Errorf("unknown inference method %d", opts.Method)
+}
+
+// BatchResult is the result of interpreting a document in a batch.
+type BatchResult struct {
+	Dist SparseDist
+	Err  error
+}
+
+// InterpretBatch interprets docs by a pool of opts.Workers goroutines,
+// and returns results in the order of docs.  As Interpret seeds each
+// document by its content, results do not depend on opts.Workers.
+// Invalid opts result in errors of all documents.
+func (intr *Interpreter) InterpretBatch(docs [][]string,
+	opts InterpretOptions) []BatchResult {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]BatchResult, len(docs))
+	parallel.ForN(0, len(docs), 1, workers, func(i int) {
+		results[i].Dist, results[i].Err =
+			intr.InterpretWithOptions(docs[i], opts)
+	})
+	return results
+}
+
+// wordPriorBucket is the sparse part of the smoothing-only bucket of
+// a word, with topics in ascending order and cumsum[i] = \sum_{j<=i}
+// a_{topics[j]} n_{topics[j],w}/(n_{topics[j]}+bV).
+type wordPriorBucket struct {
+	topics []int32
+	cumsum []float64
+}
+
+type wordPriorCache struct {
 	accessor *ModelAccessor
-	cache    map[int32][]float64
+	cache    map[int32]*wordPriorBucket
 }
 
-func newDistCache(a *ModelAccessor) *distCache {
-	return &distCache{
+func newWordPriorCache(a *ModelAccessor) *wordPriorCache {
+	return &wordPriorCache{
 		accessor: a,
-		cache:    make(map[int32][]float64)}
+		cache:    make(map[int32]*wordPriorBucket)}
+}
+
+func (c *wordPriorCache) Get(word int32) *wordPriorBucket {
+	if b, ok := c.cache[word]; ok {
+		return b
+	}
+	b := &wordPriorBucket{}
+	if h := c.accessor.WordTopicHists[word]; h != nil {
+		var counts []int64
+		b.topics, counts = h.AppendNonZeros(nil, nil)
+		hist.SortByTopic(b.topics, counts)
+		b.cumsum = make([]float64, len(b.topics))
+		var sum float64
+		for i, topic := range b.topics {
+			sum += c.accessor.TopicPrior[topic] * float64(counts[i]) /
+				(c.accessor.WordPriorSum +
+					float64(c.accessor.GlobalTopicHist.At(int(topic))))
+			b.cumsum[i] = sum
+		}
+	}
+	c.cache[word] = b
+	return b
 }
 
-func (c *distCache) Get(word int32) []float64 {
-	if dist, ok := c.cache[word]; ok {
-		return dist
+// prefix returns \sum_{topics[i]<=topic} cumsum[i].
+func (b *wordPriorBucket) prefix(topic int) float64 {
+	i := sort.Search(len(b.topics), func(i int) bool {
+		return int(b.topics[i]) > topic
+	})
+	if i == 0 {
+		return 0
 	}
-	dist := c.accessor.WordTopicDist(word)
-	c.cache[word] = dist
-	return dist
+	return b.cumsum[i-1]
 }
 
+// sampleTopic reuses docTopicBucket, whose capacity is the length of
+// doc, as the document topic bucket, so it does not allocate.
 func (intr *Interpreter) sampleTopic(doc *Document, word int32,
-	smoothingOnlyBucket []float64, rng *rand.Rand) int32 {
+	smoothingOnlyBucket *wordPriorBucket, docTopicBucket SparseDist,
+	rng *rand.Rand) int32 {
 
 	docTopicBucket, docTopicSum := intr.calculateDocumentTopicBucket(
-		doc, word, smoothingOnlyBucket)
+		doc, word, docTopicBucket)
 	var newTopic int32 = -1
 	sample := rng.Float64() * (docTopicSum + intr.smoothingOnlySum[int(word)])
 
@@ -127,16 +551,15 @@ func (intr *Interpreter) sampleTopic(doc *Document, word int32,
 			}
 		}
 	} else { // sample is in smoothing only bucket
+		// Binary search for the first topic whose cumulative
+		// smoothing-only probability reaches sample.
 		sample -= docTopicSum
-		i := 0
-		sample -= smoothingOnlyBucket[i] * intr.model.TopicPrior[i]
-		for sample > 0 {
-			i++
-			sample -= smoothingOnlyBucket[i] * intr.model.TopicPrior[i]
-		}
-		if i >= intr.model.NumTopics() {
-			panic(fmt.Sprintf("i (%d) >= model.NumTopics() (%d)",
-				i, intr.model.NumTopics()))
+		i := sort.Search(intr.model.NumTopics(), func(i int) bool {
+			return intr.smoothingOnlyCumsum[i]+
+				smoothingOnlyBucket.prefix(i) >= sample
+		})
+		if i >= intr.model.NumTopics() { // guards against rounding errors
+			i = intr.model.NumTopics() - 1
 		}
 		newTopic = int32(i)
 	}
@@ -148,18 +571,17 @@ func (intr *Interpreter) sampleTopic(doc *Document, word int32,
 }
 
 func (intr *Interpreter) calculateDocumentTopicBucket(doc *Document,
-	word int32, smoothingOnlyBucket []float64) (SparseDist, float64) {
+	word int32, docTopicBucket SparseDist) (SparseDist, float64) {
 
-	docTopicBucket := make(SparseDist, 0, doc.Len())
+	docTopicBucket = docTopicBucket[:0]
 	var docTopicSum float64
 
-	doc.TopicHist.ForEach(func(topic int, count int64) error {
-		docTopicBucket = append(docTopicBucket, Prob{
-			int32(topic),
-			float64(count) * smoothingOnlyBucket[topic]})
-		docTopicSum += float64(count) * smoothingOnlyBucket[topic]
-		return nil
-	})
+	for i, topic := range doc.TopicHist.Topics {
+		p := float64(doc.TopicHist.Counts[i]) *
+			intr.model.WordTopicProb(word, int(topic))
+		docTopicBucket = append(docTopicBucket, Prob{topic, p})
+		docTopicSum += p
+	}
 	return docTopicBucket, docTopicSum
 }
 
@@ -169,6 +591,9 @@ type Prob struct {
 }
 type SparseDist []Prob
 
-func (a SparseDist) Len() int           { return len(a) }
-func (a SparseDist) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a SparseDist) Less(i, j int) bool { return a[i].Prob > a[j].Prob }
+func (a SparseDist) Len() int      { return len(a) }
+func (a SparseDist) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a SparseDist) Less(i, j int) bool {
+	return a[i].Prob > a[j].Prob ||
+		a[i].Prob == a[j].Prob && a[i].Topic < a[j].Topic
+}
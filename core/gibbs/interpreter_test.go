@@ -2,6 +2,9 @@ package gibbs
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
 	"testing"
 )
 
@@ -45,3 +48,235 @@ func TestInterpret(t *testing.T) {
 		}
 	}
 }
+
+func TestInterpretWithAttribution(t *testing.T) {
+	m, v, e := CreateTestingOptimizedModel()
+	if e != nil {
+		t.Skip(e)
+	}
+	intr := NewInterpreter(m, v, -1)
+
+	doc := []string{"tiger", "unknown", "apple", "orange"}
+	dist, attrs, e := intr.InterpretWithAttribution(doc, 50, 100)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if d, _ := intr.Interpret(doc, 50, 100); !reflect.DeepEqual(d, dist) {
+		t.Errorf("Expecting the same distribution %v, got %v", d, dist)
+	}
+	truth := "[{tiger false 1 0.7142857142857143} {unknown true 0 0} " +
+		"{apple false 0 1} {orange false 0 1}]"
+	if s := fmt.Sprint(attrs); s != truth {
+		t.Errorf("Expecting %s, got %s", truth, s)
+	}
+
+	_, attrs, e = intr.InterpretWithAttribution([]string{"unknown"}, 50, 100)
+	if fmt.Sprint(e) != ErrEmptyDoc || len(attrs) != 1 || !attrs[0].OOV {
+		t.Errorf("Expecting an OOV attribution and error %s, got %v %v",
+			ErrEmptyDoc, attrs, e)
+	}
+
+	if _, _, e := intr.InterpretWithAttribution(doc, 50, 50); e == nil {
+		t.Errorf("Expecting an error with iterations <= burn-in")
+	}
+	if _, e := intr.Interpret(doc, 50, 50); e == nil {
+		t.Errorf("Expecting an error with iterations <= burn-in")
+	}
+}
+
+// TestInterpretVariational compares InterpretVariational with
+// Interpret of many iterations, which approximates the exact posterior.
+func TestInterpretVariational(t *testing.T) {
+	m, v, e := CreateTestingOptimizedModel()
+	if e != nil {
+		t.Skip(e)
+	}
+	intr := NewInterpreter(m, v, -1)
+
+	for _, doc := range [][]string{
+		{"tiger"}, {"cat"}, {"apple"}, {"orange"}, {"unknown", "apple"},
+		{"tiger", "cat"}, {"apple", "orange"}, {"tiger", "apple"},
+		{"tiger", "apple", "orange"}} {
+		d, e := intr.InterpretVariational(doc, 1e-4, 100)
+		if e != nil {
+			t.Fatal(doc, e)
+		}
+		sum := 0.0
+		for _, p := range d {
+			sum += p.Prob
+			if !inWordTopicHists(m, v, doc, p.Topic) {
+				t.Errorf("%v: expecting sparse topics, got %d", doc, p.Topic)
+			}
+		}
+		if sum > 1+1e-9 {
+			t.Errorf("%v: expecting probabilities sum <= 1, got %f", doc, sum)
+		}
+		r, _ := intr.InterpretVariational(doc, 1e-4, 100)
+		if !reflect.DeepEqual(r, d) {
+			t.Errorf("%v: expecting deterministic result %v, got %v",
+				doc, d, r)
+		}
+		g, _ := intr.Interpret(doc, 50, 2050)
+		if l1 := l1Distance(d, g); l1 > 0.1 {
+			t.Errorf("%v: variational %v too far from Gibbs %v: %f",
+				doc, d, g, l1)
+		} else {
+			t.Logf("%v: variational %v, Gibbs %v, L1 %f", doc, d, g, l1)
+		}
+	}
+
+	for _, doc := range [][]string{{}, {"unknown"}} {
+		_, e := intr.InterpretVariational(doc, 1e-4, 100)
+		if fmt.Sprint(e) != ErrEmptyDoc {
+			t.Errorf("%v: expecting error %s, got %v", doc, ErrEmptyDoc, e)
+		}
+	}
+
+	doc := []string{"apple"}
+	if _, e := intr.InterpretVariational(doc, 0, 100); e == nil {
+		t.Errorf("Expecting an error with tolerance 0")
+	}
+	if _, e := intr.InterpretVariational(doc, 1e-4, 0); e == nil {
+		t.Errorf("Expecting an error with maxIter 0")
+	}
+	opts := DefaultInterpretOptions()
+	opts.Method = InferenceMethod(-1)
+	if _, e := intr.InterpretWithOptions(doc, opts); e == nil {
+		t.Errorf("Expecting an error with an unknown method")
+	}
+	opts.Method, opts.Iterations = Gibbs, opts.BurnIn
+	if _, e := intr.InterpretWithOptions(doc, opts); e == nil {
+		t.Errorf("Expecting an error with iterations <= burn-in")
+	}
+}
+
+// inWordTopicHists returns true if any in-vocabulary word of doc has
+// non-zero count in topic.
+func inWordTopicHists(m *Model, v *Vocabulary, doc []string,
+	topic int32) bool {
+	for _, w := range doc {
+		if id := v.Id(w); id >= 0 && m.WordTopicHists[id] != nil &&
+			m.WordTopicHists[id].At(int(topic)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func l1Distance(a, b SparseDist) float64 {
+	m := make(map[int32]float64)
+	for _, p := range a {
+		m[p.Topic] += p.Prob
+	}
+	for _, p := range b {
+		m[p.Topic] -= p.Prob
+	}
+	var d float64
+	for _, x := range m {
+		d += math.Abs(x)
+	}
+	return d
+}
+
+func TestInterpretBatch(t *testing.T) {
+	m, v, e := CreateTestingOptimizedModel()
+	if e != nil {
+		t.Skip(e)
+	}
+	v.ids = nil // Tests that NewInterpreter builds the map.
+	intr := NewInterpreter(m, v, 0)
+
+	words := []string{"apple", "orange", "cat", "tiger", "unknown"}
+	rng := rand.New(rand.NewSource(-1))
+	docs := make([][]string, 100)
+	for i := range docs {
+		for j := rng.Intn(4); j >= 0; j-- {
+			docs[i] = append(docs[i], words[rng.Intn(len(words))])
+		}
+	}
+
+	opts := DefaultInterpretOptions()
+	for _, method := range []InferenceMethod{Gibbs, Variational} {
+		for _, workers := range []int{1, 4} {
+			opts.Method, opts.Workers = method, workers
+			results := intr.InterpretBatch(docs, opts)
+			if len(results) != len(docs) {
+				t.Fatalf("Expecting %d results, got %d",
+					len(docs), len(results))
+			}
+			for i, r := range results {
+				d, e := intr.InterpretWithOptions(docs[i], opts)
+				if fmt.Sprint(r.Err) != fmt.Sprint(e) ||
+					!reflect.DeepEqual(r.Dist, d) {
+					t.Errorf("%d workers, %v: expecting %v %v, got %v %v",
+						workers, docs[i], d, e, r.Dist, r.Err)
+				}
+			}
+		}
+	}
+}
+
+var benchmarkInterpretDoc = []string{"tiger", "apple", "orange", "cat"}
+
+func BenchmarkInterpretGibbs(b *testing.B) {
+	benchmarkInterpret(b, Gibbs)
+}
+
+func BenchmarkInterpretVariational(b *testing.B) {
+	benchmarkInterpret(b, Variational)
+}
+
+func benchmarkInterpret(b *testing.B, method InferenceMethod) {
+	m, v, e := CreateTestingOptimizedModel()
+	if e != nil {
+		b.Skip(e)
+	}
+	intr := NewInterpreter(m, v, -1)
+	opts := DefaultInterpretOptions()
+	opts.Method = method
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intr.InterpretWithOptions(benchmarkInterpretDoc, opts)
+	}
+}
+
+// BenchmarkInterpretGibbsLargeK and BenchmarkInterpretVariationalLargeK
+// interpret a long document with a model of many topics without
+// caching word-topic distributions.
+func BenchmarkInterpretGibbsLargeK(b *testing.B) {
+	benchmarkInterpretLargeK(b, Gibbs)
+}
+
+func BenchmarkInterpretVariationalLargeK(b *testing.B) {
+	benchmarkInterpretLargeK(b, Variational)
+}
+
+func benchmarkInterpretLargeK(b *testing.B, method InferenceMethod) {
+	m, corpus := createLargeKCorpus()
+	v := NewVocabulary()
+	for w := 0; w < m.VocabSize(); w++ {
+		v.Tokens = append(v.Tokens, fmt.Sprint(w))
+	}
+	intr := NewInterpreter(m, v, 0)
+	var doc []string
+	for _, w := range corpus[0].Words {
+		doc = append(doc, v.Token(w))
+	}
+	opts := DefaultInterpretOptions()
+	opts.Method = method
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intr.InterpretWithOptions(doc, opts)
+	}
+}
+
+// BenchmarkNewInterpreterLargeK measures the startup time of
+// Interpreter.
+func BenchmarkNewInterpreterLargeK(b *testing.B) {
+	m, _ := createLargeKCorpus()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewInterpreter(m, nil, 100)
+	}
+}
@@ -0,0 +1,43 @@
+package gibbs
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Kernel is a Gibbs sampling algorithm that updates the topic
+// assignments of a document given a model.  Trainers program against
+// Kernel, so they can switch between sampling algorithms, for
+// example, SparseLDA (Sampler) and the alias-table Metropolis-Hastings
+// sampler (AliasSampler), without changing the training loop.
+type Kernel interface {
+	// Sample updates doc.Topics, doc.TopicHist and the model.
+	Sample(doc *Document, rng *rand.Rand)
+
+	// SetDiff and GetDiff record Gibbs updates into a model, as
+	// described in Sampler.SetDiff.
+	SetDiff(d *Model)
+	GetDiff() *Model
+
+	// AfterOptimization must be called after the model's priors or
+	// GlobalTopicHist were changed by others than the kernel.
+	AfterOptimization()
+}
+
+const (
+	SparseLDAKernel = "sparselda"
+	AliasKernel     = "alias"
+)
+
+// NewKernel creates a sampling kernel by name, which is usually the
+// value of the command line flag -kernel of trainers.
+func NewKernel(name string, m *Model) (Kernel, error) {
+	switch name {
+	case SparseLDAKernel, "":
+		return NewSampler(m), nil
+	case AliasKernel:
+		return NewAliasSampler(m), nil
+	}
+	return nil, fmt.Errorf("Unknown sampling kernel %s, expecting %s or %s",
+		name, SparseLDAKernel, AliasKernel)
+}
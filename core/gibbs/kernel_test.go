@@ -0,0 +1,22 @@
+package gibbs
+
+import (
+	"testing"
+)
+
+func TestNewKernel(t *testing.T) {
+	m := CreateTestingModel()
+	if k, e := NewKernel(SparseLDAKernel, m); e != nil {
+		t.Errorf("Unexpected error: %v", e)
+	} else if _, ok := k.(*Sampler); !ok {
+		t.Errorf("Expecting *Sampler, got %T", k)
+	}
+	if k, e := NewKernel(AliasKernel, m); e != nil {
+		t.Errorf("Unexpected error: %v", e)
+	} else if _, ok := k.(*AliasSampler); !ok {
+		t.Errorf("Expecting *AliasSampler, got %T", k)
+	}
+	if _, e := NewKernel("unknown", m); e == nil {
+		t.Errorf("Expecting an error for unknown kernel")
+	}
+}
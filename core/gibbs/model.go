@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/wangkuiyi/phoenix/core/hist"
 	"io"
+	"math"
 )
 
 type Model struct {
@@ -13,20 +14,35 @@ type Model struct {
 	TopicPriorSum   float64
 	WordPrior       float64
 	WordPriorSum    float64
+
+	newHist func(token int32) hist.Hist // creates word topic-histograms
 }
 
+// NewModel is the same as MakeModel, but panics on invalid
+// parameters.
 func NewModel(numTopics, vocabSize int, topicPrior, wordPrior float64) *Model {
+	m, e := MakeModel(numTopics, vocabSize, topicPrior, wordPrior)
+	if e != nil {
+		panic(e.Error())
+	}
+	return m
+}
+
+// MakeModel creates an empty model with symmetric priors, or returns
+// an error if the parameters are invalid.
+func MakeModel(numTopics, vocabSize int, topicPrior, wordPrior float64) (
+	*Model, error) {
 	if numTopics < 2 {
-		panic(fmt.Sprintf("numTopics = %d, less than 2", numTopics))
+		return nil, fmt.Errorf("numTopics = %d, less than 2", numTopics)
 	}
 	if vocabSize < 2 {
-		panic(fmt.Sprintf("vocabSize = %d, less than 2", vocabSize))
+		return nil, fmt.Errorf("vocabSize = %d, less than 2", vocabSize)
 	}
 	if topicPrior <= 0.0 {
-		panic(fmt.Sprintf("topicPrior = %f, less than 0", topicPrior))
+		return nil, fmt.Errorf("topicPrior = %f, less than 0", topicPrior)
 	}
 	if wordPrior <= 0.0 {
-		panic(fmt.Sprintf("wordPrior = %f, less than 0", wordPrior))
+		return nil, fmt.Errorf("wordPrior = %f, less than 0", wordPrior)
 	}
 	m := &Model{
 		GlobalTopicHist: hist.NewDense(numTopics),
@@ -39,7 +55,53 @@ func NewModel(numTopics, vocabSize int, topicPrior, wordPrior float64) *Model {
 	for i := range m.TopicPrior {
 		m.TopicPrior[i] = topicPrior
 	}
-	return m
+	return m, nil
+}
+
+// Validate checks the consistency of a model, e.g., one decoded from
+// a file, so that accessing it does not panic.
+func (m *Model) Validate() error {
+	if m.GlobalTopicHist == nil {
+		return fmt.Errorf("GlobalTopicHist is nil")
+	}
+	if _, ok := m.GlobalTopicHist.(hist.Dense); !ok {
+		return fmt.Errorf("GlobalTopicHist is %T, expecting hist.Dense",
+			m.GlobalTopicHist)
+	}
+	if m.NumTopics() < 2 {
+		return fmt.Errorf("numTopics = %d, less than 2", m.NumTopics())
+	}
+	if m.VocabSize() < 2 {
+		return fmt.Errorf("vocabSize = %d, less than 2", m.VocabSize())
+	}
+	if len(m.TopicPrior) != m.NumTopics() {
+		return fmt.Errorf("%d topic priors, but %d topics",
+			len(m.TopicPrior), m.NumTopics())
+	}
+	for k, p := range m.TopicPrior {
+		if p <= 0.0 {
+			return fmt.Errorf("topicPrior[%d] = %f, less than 0", k, p)
+		}
+	}
+	if m.WordPrior <= 0.0 {
+		return fmt.Errorf("wordPrior = %f, less than 0", m.WordPrior)
+	}
+	K := m.NumTopics()
+	for w, h := range m.WordTopicHists {
+		if h == nil {
+			continue
+		}
+		if e := h.ForEach(func(topic int, count int64) error {
+			if topic < 0 || topic >= K {
+				return fmt.Errorf("word %d has topic %d, out of [0, %d)",
+					w, topic, K)
+			}
+			return nil
+		}); e != nil {
+			return e
+		}
+	}
+	return nil
 }
 
 func (m *Model) NumTopics() int {
@@ -54,25 +116,63 @@ func (m *Model) WordTopicHist(token int32) hist.Hist {
 	if h := m.WordTopicHists[token]; h != nil {
 		return h
 	}
-	h := hist.NewSparse()
+	var h hist.Hist
+	if m.newHist != nil {
+		h = m.newHist(token)
+	} else {
+		h = hist.NewSparse()
+	}
 	m.WordTopicHists[token] = h
 	return h
 }
 
+// Pack converts word topic-histograms of m into hist.Packed, and makes
+// m create hist.Packed for words that it has not seen.  This saves
+// memory of large models.  A model loaded from gob keeps its
+// hist.Packed histograms, but creates hist.Sparse for new words unless
+// Pack is called again.
+//
+// Pack must not be called with models used as diffs by Sampler.SetDiff,
+// as a diff has negative counts, which hist.Packed does not allow, or
+// with models of hist.MaxPackedTopics or more topics.
+func (m *Model) Pack() {
+	if m.NumTopics() > hist.MaxPackedTopics {
+		panic(fmt.Sprintf("%d topics, more than %d",
+			m.NumTopics(), hist.MaxPackedTopics))
+	}
+	for w, h := range m.WordTopicHists {
+		if h == nil {
+			continue
+		}
+		if _, ok := h.(*hist.Packed); !ok {
+			p := hist.NewPacked()
+			h.ForEach(func(t int, c int64) error {
+				if c > 0 {
+					p.Inc(t, int(c))
+				}
+				return nil
+			})
+			m.WordTopicHists[w] = p
+		}
+	}
+	m.newHist = func(int32) hist.Hist { return hist.NewPacked() }
+}
+
 func (m *Model) PrintTopics(w io.Writer, v *Vocabulary) {
 	m.PrintTopicsTopNWords(w, v, 1.0)
 }
 
 // PrintTopicsTopNWords prints each topic as words with P(w|z) in
 // descending order.  Parameter percentage is used to call
-// Model.GetTopNWords() and controls how many words to be printed for
+// TopicIndex.TopNWords() and controls how many words to be printed for
 // each topic.
 func (m *Model) PrintTopicsTopNWords(w io.Writer, v *Vocabulary,
 	percentage float64) {
 
+	x := NewTopicIndex(m)
 	m.GlobalTopicHist.ForEach(func(topic int, count int64) error {
 		fmt.Fprintf(w, "Topic %05d Nt %05d:", topic, count)
-		if h := m.GetTopNWords(topic, percentage); h != nil {
+		if h := x.TopNWords(topic, percentage); h != nil {
 			h.ForEach(func(t int, count int64) error {
 				fmt.Fprintf(w, " %s (%d)", v.Token(int32(t)), count)
 				return nil
@@ -83,7 +183,9 @@ func (m *Model) PrintTopicsTopNWords(w io.Writer, v *Vocabulary,
 	})
 }
 
-// GetTopWords returns tokens in a given topic and their weights.
+// GetTopWords returns tokens in a given topic and their weights.  It
+// walks histograms of all words; to query many topics, use
+// TopicIndex.
 func (m *Model) GetTopWords(topic int) hist.Hist {
 	wordHist := hist.NewSparse()
 	for word, h := range m.WordTopicHists {
@@ -108,17 +210,8 @@ func (m *Model) GetTopWords(topic int) hist.Hist {
 func (m *Model) GetTopNWords(topic int, percentage float64) hist.Hist {
 	// GetTopNWords requires the GetTopWords returns hist.OrderedSparse.
 	if o := m.GetTopWords(topic); o != nil {
-		h := o.(*hist.OrderedSparse)
-		var accum int
-		for i := 0; i < h.Len(); i++ {
-			accum += int(h.Counts[i])
-			if accum >= int(float64(m.GlobalTopicHist.At(topic))*percentage) {
-				h.Topics = h.Topics[0 : i+1]
-				h.Counts = h.Counts[0 : i+1]
-				break
-			}
-		}
-		return h
+		return truncateTopWords(o.(*hist.OrderedSparse),
+			m.GlobalTopicHist.At(topic), percentage)
 	}
 	return nil
 }
@@ -150,6 +243,71 @@ func (m *Model) Accumulate(hists map[int]hist.Hist) {
 	}
 }
 
+// ApplyDiff adds word-topic histograms of diff, which are usually
+// recorded by Sampler.SetDiff, to m and updates m.GlobalTopicHist
+// accordingly.  Unlike Accumulate, ApplyDiff never lets m share
+// histograms with diff, so diff can be applied to more than one
+// model.
+func (m *Model) ApplyDiff(diff *Model) {
+	m.applyDiff(diff, 1)
+}
+
+// RevertDiff undoes ApplyDiff(diff).
+func (m *Model) RevertDiff(diff *Model) {
+	m.applyDiff(diff, -1)
+}
+
+func (m *Model) applyDiff(diff *Model, sign int64) {
+	for w, h := range diff.WordTopicHists {
+		if h == nil {
+			continue
+		}
+		d := m.WordTopicHist(int32(w))
+		h.ForEach(func(t int, c int64) error {
+			if c *= sign; c > 0 {
+				d.Inc(t, int(c))
+				m.GlobalTopicHist.Inc(t, int(c))
+			} else if c < 0 {
+				d.Dec(t, int(-c))
+				m.GlobalTopicHist.Dec(t, int(-c))
+			}
+			return nil
+		})
+	}
+}
+
+// Decay multiplies all counts in m by factor, which is in [0, 1], and
+// rounds results down, so that repeated decays with a factor less
+// than 1 drive all counts to 0.  Online training uses it to forget old
+// documents gradually.  A factor of 0 forgets all.
+func (m *Model) Decay(factor float64) {
+	if factor < 0 || factor > 1 {
+		panic(fmt.Sprintf("decay factor (%f) not in [0, 1]", factor))
+	}
+	for w, h := range m.WordTopicHists {
+		if h == nil {
+			continue
+		}
+		// Collect decrements before applying them, as some Hist
+		// implementations do not allow updates in ForEach.
+		decs := hist.NewSparse()
+		h.ForEach(func(t int, c int64) error {
+			if d := c - int64(math.Floor(float64(c)*factor)); d > 0 {
+				decs.Inc(t, int(d))
+			}
+			return nil
+		})
+		decs.ForEach(func(t int, d int64) error {
+			h.Dec(t, int(d))
+			m.GlobalTopicHist.Dec(t, int(d))
+			return nil
+		})
+		if h.Len() == 0 {
+			m.WordTopicHists[w] = nil
+		}
+	}
+}
+
 // Clone uses gob.Encode/Decode to do deep clone of a model.
 func (m *Model) Clone() *Model {
 	n := NewModel(m.NumTopics(), m.VocabSize(), 1.0, 1.0)
@@ -158,6 +316,7 @@ func (m *Model) Clone() *Model {
 	n.TopicPriorSum = m.TopicPriorSum
 	n.WordPrior = m.WordPrior
 	n.WordPriorSum = m.WordPriorSum
+	n.newHist = m.newHist
 	copy(n.GlobalTopicHist.(hist.Dense), m.GlobalTopicHist.(hist.Dense))
 	for w, h := range m.WordTopicHists {
 		if h == nil {
@@ -2,13 +2,18 @@ package gibbs
 
 import (
 	"container/heap"
+	"github.com/wangkuiyi/parallel"
+	"runtime"
+	"sync"
 	"unsafe"
 )
 
 type ModelAccessor struct {
 	*Model
 	WordTopicDists [][]float64
-	smoothingOnly  []float64
+
+	smoothingOnly     []float64 // built by buildSmoothingOnly once
+	smoothingOnlyOnce sync.Once
 }
 
 // Creates a ModelAccessor instance, which contains
@@ -16,12 +21,12 @@ type ModelAccessor struct {
 // but might not include all topic distributions as memory space is
 // constrained by cacheSizeMB.  However, if cacheSizeMB is a negative,
 // topic distributions of all words in the vocabulary will be
-// included.
+// included.  Word frequencies and cached distributions are computed
+// in parallel.
 func NewModelAccessor(model *Model, cacheSizeMB int) *ModelAccessor {
 	a := &ModelAccessor{
-		model,
-		make([][]float64, model.VocabSize()),
-		nil}
+		Model:          model,
+		WordTopicDists: make([][]float64, model.VocabSize())}
 
 	// The maximum number C of topic distributions that can be cached.
 	cached := model.VocabSize()
@@ -34,17 +39,23 @@ func NewModelAccessor(model *Model, cacheSizeMB int) *ModelAccessor {
 
 	if cached > 0 {
 		// Count the word frequncies and select the largest C words.
-		h := newMinHeap(len(model.WordTopicHists))
-		heap.Init(h)
-		for word, hist := range model.WordTopicHists {
-			var freq int64
-			if hist != nil {
-				hist.ForEach(func(_ int, count int64) error {
-					freq += count
-					return nil
-				})
+		freqs := make([]int64, len(model.WordTopicHists))
+		parallelRanges(len(freqs), func(begin, end int) {
+			var topics []int32
+			var counts []int64
+			for word := begin; word < end; word++ {
+				if hist := model.WordTopicHists[word]; hist != nil {
+					topics, counts = hist.AppendNonZeros(topics[:0], counts[:0])
+					for _, c := range counts {
+						freqs[word] += c
+					}
+				}
 			}
+		})
 
+		h := newMinHeap(len(model.WordTopicHists))
+		heap.Init(h)
+		for word, freq := range freqs {
 			if len(*h) < cached {
 				heap.Push(h, wordFreq{word, freq})
 			} else if freq > (*h)[0].freq {
@@ -54,29 +65,51 @@ func NewModelAccessor(model *Model, cacheSizeMB int) *ModelAccessor {
 		}
 
 		// Cache topic distributions of the largest C words.
-		for h.Len() > 0 {
-			wf := heap.Pop(h).(wordFreq)
-			dist := a.buildSmoothingOnly()
-			a.cumulatePosterior(dist, int32(wf.word))
-			a.WordTopicDists[wf.word] = dist
-		}
+		parallelRanges(h.Len(), func(begin, end int) {
+			for _, wf := range (*h)[begin:end] {
+				dist := a.buildSmoothingOnly()
+				a.cumulatePosterior(dist, int32(wf.word))
+				a.WordTopicDists[wf.word] = dist
+			}
+		})
 	}
 	return a
 }
 
+// parallelRanges divides [0, n) into GOMAXPROCS ranges, and calls f
+// with each range in parallel.
+func parallelRanges(n int, f func(begin, end int)) {
+	chunks := runtime.GOMAXPROCS(0)
+	if chunks > n {
+		chunks = n
+	}
+	parallel.For(0, chunks, 1, func(i int) error {
+		f(i*n/chunks, (i+1)*n/chunks)
+		return nil
+	})
+}
+
+// buildSmoothingOnly returns a copy of the smoothing-only
+// distribution, which is built when it is called for the first time.
+// It is safe to be called concurrently.
 func (a *ModelAccessor) buildSmoothingOnly() []float64 {
-	if len(a.smoothingOnly) <= 0 {
+	dist := make([]float64, a.NumTopics())
+	copy(dist, a.getSmoothingOnly())
+	return dist
+}
+
+// getSmoothingOnly returns the smoothing-only distribution, which must
+// not be changed.
+func (a *ModelAccessor) getSmoothingOnly() []float64 {
+	a.smoothingOnlyOnce.Do(func() {
 		dist := make([]float64, a.NumTopics())
 		a.GlobalTopicHist.ForEach(func(topic int, count int64) error {
 			dist[topic] = a.WordPrior / (a.WordPriorSum + float64(count))
 			return nil
 		})
 		a.smoothingOnly = dist
-	}
-
-	dist := make([]float64, a.NumTopics())
-	copy(dist, a.smoothingOnly)
-	return dist
+	})
+	return a.smoothingOnly
 }
 
 func (a *ModelAccessor) cumulatePosterior(dist []float64, token int32) {
@@ -100,6 +133,34 @@ func (a *ModelAccessor) WordTopicDist(token int32) []float64 {
 	return dist
 }
 
+// wordTopicDistTo is WordTopicDist, but fills dist, a buffer of K
+// elements, instead of allocating if the distribution of token is not
+// cached.  The returned distribution must not be changed.
+func (a *ModelAccessor) wordTopicDistTo(dist []float64, token int32) []float64 {
+	if d := a.WordTopicDists[token]; d != nil {
+		return d
+	}
+	copy(dist, a.getSmoothingOnly())
+	a.cumulatePosterior(dist, token)
+	return dist
+}
+
+// WordTopicProb returns the probability of token given topic.  Unlike
+// WordTopicDist, it does not allocate a K-dimensional vector for
+// tokens whose distributions are not cached.
+func (a *ModelAccessor) WordTopicProb(token int32, topic int) float64 {
+	if dist := a.WordTopicDists[token]; dist != nil {
+		return dist[topic]
+	}
+
+	var count int64
+	if hist := a.WordTopicHists[token]; hist != nil {
+		count = hist.At(topic)
+	}
+	return (float64(count) + a.WordPrior) /
+		(a.WordPriorSum + float64(a.GlobalTopicHist.At(topic)))
+}
+
 type minHeap []wordFreq
 type wordFreq struct {
 	word int
@@ -4,6 +4,8 @@ import (
 	"container/heap"
 	"fmt"
 	"math/rand"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -37,3 +39,50 @@ func TestNewModelAccessor(t *testing.T) {
 		t.Errorf("Expecting %s, got %s", truth, fmt.Sprint(a.WordTopicDists))
 	}
 }
+
+func TestModelAccessorConcurrent(t *testing.T) {
+	m, _ := createLargeKCorpusWithSize(50, 500, 20, 50)
+	truth := NewModelAccessor(m, 0)
+	for w := 0; w < m.VocabSize(); w++ {
+		truth.WordTopicDist(int32(w))
+	}
+
+	a := NewModelAccessor(m, 0)
+	var wg sync.WaitGroup
+	dists := make([][]float64, m.VocabSize())
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for w := g; w < m.VocabSize(); w += 4 {
+				dists[w] = a.WordTopicDist(int32(w))
+			}
+		}(g)
+	}
+	wg.Wait()
+	for w := range dists {
+		if !reflect.DeepEqual(dists[w], truth.WordTopicDist(int32(w))) {
+			t.Errorf("Word %d: expecting %v, got %v",
+				w, truth.WordTopicDist(int32(w)), dists[w])
+		}
+	}
+
+	c := NewModelAccessor(m, -1)
+	for w := range dists {
+		if !reflect.DeepEqual(c.WordTopicDists[w], dists[w]) {
+			t.Errorf("Word %d: expecting cached %v, got %v",
+				w, dists[w], c.WordTopicDists[w])
+		}
+	}
+}
+
+// BenchmarkNewModelAccessorLargeK measures the startup time of
+// ModelAccessor.  Run it with -cpu=1,4 to compare parallel with serial
+// construction.
+func BenchmarkNewModelAccessorLargeK(b *testing.B) {
+	m, _ := createLargeKCorpus()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewModelAccessor(m, 100)
+	}
+}
@@ -19,6 +19,51 @@ func TestNewModel(t *testing.T) {
 	}
 }
 
+func TestMakeModel(t *testing.T) {
+	if _, e := MakeModel(1, testingV, testingAlpha, testingBeta); e == nil {
+		t.Errorf("Expecting error for 1 topic")
+	}
+	if _, e := MakeModel(testingK, testingV, testingAlpha, 0); e == nil {
+		t.Errorf("Expecting error for zero word prior")
+	}
+	m, e := MakeModel(testingK, testingV, testingAlpha, testingBeta)
+	if e != nil || m.Validate() != nil {
+		t.Errorf("Expecting a valid model, got %v", e)
+	}
+}
+
+func TestModelValidate(t *testing.T) {
+	m := CreateTestingModel()
+	if e := m.Validate(); e != nil {
+		t.Errorf("Expecting valid model, got %v", e)
+	}
+	m.TopicPrior = m.TopicPrior[:1]
+	if e := m.Validate(); e == nil {
+		t.Errorf("Expecting error for mismatched topic priors")
+	}
+	if e := new(Model).Validate(); e == nil {
+		t.Errorf("Expecting error for empty model")
+	}
+
+	m = CreateTestingModel()
+	m.WordTopicHists[0] = hist.Sparse{testingK: 1}
+	if e := m.Validate(); e == nil {
+		t.Errorf("Expecting error for out-of-range topic")
+	}
+
+	m = CreateTestingModel()
+	m.TopicPrior[1] = 0
+	if e := m.Validate(); e == nil {
+		t.Errorf("Expecting error for zero topic prior")
+	}
+
+	m = CreateTestingModel()
+	m.GlobalTopicHist = hist.Sparse{0: 1, 1: 1}
+	if e := m.Validate(); e == nil {
+		t.Errorf("Expecting error for sparse global topic histogram")
+	}
+}
+
 func TestModelAccumulate(t *testing.T) {
 	m := CreateTestingModel()
 	s := map[int]hist.Hist{
@@ -36,6 +81,96 @@ func TestModelAccumulate(t *testing.T) {
 	}
 }
 
+func TestModelApplyDiff(t *testing.T) {
+	m := CreateTestingModel()
+	d := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	d.WordTopicHist(0).Inc(0, 10)
+	d.WordTopicHist(1).Dec(1, 1)
+	d.WordTopicHist(1).Inc(0, 1)
+	m.ApplyDiff(d)
+
+	truth := []hist.Hist{
+		hist.Sparse{0: 10},
+		hist.Sparse{0: 1},
+		nil,
+		hist.Sparse{1: 1}}
+	if !reflect.DeepEqual(m.WordTopicHists, truth) {
+		t.Errorf("Expecting %s, got %s", truth, fmt.Sprint(m.WordTopicHists))
+	}
+	if g := fmt.Sprint(m.GlobalTopicHist); g != "[11 1]" {
+		t.Errorf("Expecting [11 1], got %s", g)
+	}
+
+	d.WordTopicHist(0).Inc(1, 1)
+	if m.WordTopicHists[0].At(1) != 0 {
+		t.Errorf("ApplyDiff must not share histograms with diff")
+	}
+
+	e := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	e.WordTopicHist(0).Inc(1, 2)
+	e.WordTopicHist(3).Dec(1, 1)
+	m.ApplyDiff(e)
+	m.RevertDiff(e)
+	if !reflect.DeepEqual(m.WordTopicHists, truth) {
+		t.Errorf("Expecting %s after RevertDiff, got %s",
+			truth, fmt.Sprint(m.WordTopicHists))
+	}
+	if g := fmt.Sprint(m.GlobalTopicHist); g != "[11 1]" {
+		t.Errorf("Expecting [11 1] after RevertDiff, got %s", g)
+	}
+}
+
+func TestModelDecay(t *testing.T) {
+	m := CreateTestingModel()
+	m.WordTopicHist(0).Inc(0, 4)
+	m.GlobalTopicHist.Inc(0, 4)
+	m.WordTopicHist(0).Inc(1, 3)
+	m.GlobalTopicHist.Inc(1, 3)
+	m.Decay(0.5)
+
+	// Singletons are forgotten.
+	truth := []hist.Hist{
+		hist.Sparse{0: 2, 1: 1},
+		nil,
+		nil,
+		nil}
+	if !reflect.DeepEqual(m.WordTopicHists, truth) {
+		t.Errorf("Expecting %s, got %s", truth, fmt.Sprint(m.WordTopicHists))
+	}
+	if g := fmt.Sprint(m.GlobalTopicHist); g != "[2 1]" {
+		t.Errorf("Expecting [2 1], got %s", g)
+	}
+
+	m.Decay(0)
+	for w, h := range m.WordTopicHists {
+		if h != nil {
+			t.Errorf("Expecting word %d forgotten, got %v", w, h)
+		}
+	}
+	if g := fmt.Sprint(m.GlobalTopicHist); g != "[0 0]" {
+		t.Errorf("Expecting [0 0], got %s", g)
+	}
+}
+
+func TestModelPack(t *testing.T) {
+	m := CreateTestingModel()
+	m.Pack()
+	truth := []hist.Hist{
+		nil,
+		hist.NewPacked().AssignSparse(hist.Sparse{1: 1}),
+		nil,
+		hist.NewPacked().AssignSparse(hist.Sparse{1: 1})}
+	if !reflect.DeepEqual(m.WordTopicHists, truth) {
+		t.Errorf("Expecting %v, got %v", truth, m.WordTopicHists)
+	}
+	if _, ok := m.WordTopicHist(0).(*hist.Packed); !ok {
+		t.Errorf("Expecting new histograms in hist.Packed")
+	}
+	if _, ok := m.Clone().WordTopicHist(2).(*hist.Packed); !ok {
+		t.Errorf("Expecting clones create hist.Packed")
+	}
+}
+
 func TestModelGobEncoding(t *testing.T) {
 	m := CreateTestingModel()
 	var b bytes.Buffer
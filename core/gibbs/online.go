@@ -0,0 +1,37 @@
+package gibbs
+
+import (
+	"math/rand"
+)
+
+// FoldIn implements online training in the streaming setting
+// described in the SparseLDA paper (*Topic Model Inference on
+// Streaming Document Collections*).  It adds docs, whose topics are
+// usually randomly initialized by InitializeDocument, into m, and
+// then runs iterations of Gibbs sampling on docs only, so topics
+// learned from old documents are refined by new ones without
+// retraining.  Topic assignments of docs are left in docs.
+//
+// k must be a kernel created for m.  If k has a diff, the new
+// documents are also applied to the diff, so the diff records all
+// changes made by FoldIn.  To forget old documents, call m.Decay
+// before FoldIn.
+func FoldIn(m *Model, docs []*Document, k Kernel, iterations int,
+	rng *rand.Rand) {
+	for _, d := range docs {
+		d.ApplyToModel(m)
+		if diff := k.GetDiff(); diff != nil {
+			d.ApplyToModel(diff)
+		}
+	}
+
+	// Both m.GlobalTopicHist and maybe the priors have been changed by
+	// others than k.
+	k.AfterOptimization()
+
+	for iter := 0; iter < iterations; iter++ {
+		for _, d := range docs {
+			k.Sample(d, rng)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package gibbs
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFoldIn(t *testing.T) {
+	v, e := CreateTestingVocabulary()
+	if e != nil {
+		t.Fatalf("Failed building testing vocabulary")
+	}
+
+	rng := rand.New(rand.NewSource(-1))
+	corpus := createTestingCorpus(v, rng)
+	old, batch := corpus[:2], corpus[2:]
+
+	// Train a model with documents about fruits.
+	m := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	for _, d := range old {
+		d.ApplyToModel(m)
+	}
+	s := NewSampler(m)
+	for iter := 0; iter < testingTotalIterations; iter++ {
+		for _, d := range old {
+			s.Sample(d, rng)
+		}
+	}
+
+	// Fold in documents about animals.
+	FoldIn(m, batch, s, testingTotalIterations, rng)
+
+	// The model must be consistent with all documents.
+	truth := NewModel(testingK, testingV, testingAlpha, testingBeta)
+	for _, d := range corpus {
+		d.ApplyToModel(truth)
+	}
+	if sprint(m.GlobalTopicHist) != sprint(truth.GlobalTopicHist) {
+		t.Errorf("Expecting %v, got %v",
+			truth.GlobalTopicHist, m.GlobalTopicHist)
+	}
+	for w := range truth.WordTopicHists {
+		if sprint(m.WordTopicHists[w]) != sprint(truth.WordTopicHists[w]) {
+			t.Errorf("Word %d: expecting %v, got %v",
+				w, truth.WordTopicHists[w], m.WordTopicHists[w])
+		}
+	}
+
+	// New documents should be in a topic other than fruits.
+	apple := m.WordTopicHists[v.Id("apple")]
+	for _, d := range batch {
+		for _, topic := range d.Topics {
+			if apple.At(int(topic)) != 0 {
+				t.Errorf("Expecting animals not in fruit topic, got %v",
+					d.Topics)
+			}
+		}
+	}
+}
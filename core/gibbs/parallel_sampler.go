@@ -0,0 +1,315 @@
+package gibbs
+
+import (
+	"fmt"
+	"github.com/wangkuiyi/parallel"
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"math/rand"
+)
+
+// ParallelSampler samples documents in parallel goroutines, which
+// share one model.  Each goroutine, or worker, samples against a view
+// of the model, which reads counts from the shared model plus sparse
+// deltas of the worker, and writes only the deltas.  The shared model
+// is read-only during sampling, and deltas are added to it after all
+// workers finish.  So the memory cost is the model plus, per worker, a
+// sparse delta histogram for each word in the partition being sampled,
+// instead of a model clone per worker.
+type ParallelSampler struct {
+	// NewSource creates the random number source of a worker, which
+	// is re-seeded for each document.  If nil, NewSource is used.
+	NewSource func() rand.Source
+
+	model   *Model
+	views   []*overlay
+	kernels []Kernel
+	deltas  [][]wordTopicDelta // deltas of partitions, reused by Sample
+}
+
+// wordTopicDelta is the change of the count of a word in a topic.
+type wordTopicDelta struct {
+	word, topic int32
+	count       int64
+}
+
+// NewParallelSampler creates a ParallelSampler that samples with
+// workers goroutines, each running a kernel named kernel as accepted
+// by NewKernel.
+func NewParallelSampler(m *Model, kernel string, workers int) (
+	*ParallelSampler, error) {
+	if workers <= 0 {
+		return nil, fmt.Errorf("workers = %d, less than 1", workers)
+	}
+	p := &ParallelSampler{
+		model:   m,
+		views:   make([]*overlay, workers),
+		kernels: make([]Kernel, workers),
+	}
+	for i := range p.views {
+		p.views[i] = newOverlay(m)
+		var e error
+		if p.kernels[i], e = NewKernel(kernel, p.views[i].view); e != nil {
+			return nil, e
+		}
+	}
+	return p, nil
+}
+
+// Sample samples every document in docs once.  docs[d] belongs to
+// partition d % partitions, and is sampled with a random number stream
+// seeded by seed(d).  Each partition is sampled against the model as
+// of the beginning of Sample plus updates of its own documents.
+// Updates of all partitions are added to the model in the order of
+// partitions before Sample returns.  So results depend on partitions
+// and seed, but not on the number of workers.
+//
+// The model must not be changed during Sample.  Priors may be changed
+// between calls to Sample.
+func (p *ParallelSampler) Sample(docs []*Document, partitions int,
+	seed func(d int) int64) {
+	if partitions <= 0 || partitions > len(docs) {
+		partitions = len(docs)
+	}
+	for len(p.deltas) < partitions {
+		p.deltas = append(p.deltas, nil)
+	}
+
+	workers := len(p.kernels)
+	parallel.For(0, workers, 1, func(i int) error {
+		o, kernel := p.views[i], p.kernels[i]
+		var rng *rand.Rand
+		if p.NewSource != nil {
+			rng = rand.New(p.NewSource())
+		} else {
+			rng = rand.New(NewSource(0))
+		}
+		for q := i; q < partitions; q += workers {
+			o.reset()
+			kernel.AfterOptimization()
+			for d := q; d < len(docs); d += partitions {
+				rng.Seed(seed(d))
+				kernel.Sample(docs[d], rng)
+			}
+			p.deltas[q] = o.appendDeltas(p.deltas[q][:0])
+		}
+		o.reset()
+		return nil
+	})
+
+	// Add deltas in a fixed order.
+	for _, delta := range p.deltas[:partitions] {
+		for _, d := range delta {
+			p.model.addDelta(d)
+		}
+	}
+}
+
+// addDelta adds d, which might be negative, to the histogram of
+// d.word and GlobalTopicHist.
+func (m *Model) addDelta(d wordTopicDelta) {
+	h := m.WordTopicHist(d.word)
+	if d.count > 0 {
+		h.Inc(int(d.topic), int(d.count))
+		m.GlobalTopicHist.Inc(int(d.topic), int(d.count))
+	} else if d.count < 0 {
+		h.Dec(int(d.topic), int(-d.count))
+		m.GlobalTopicHist.Dec(int(d.topic), int(-d.count))
+	}
+}
+
+// overlay maintains view, a model whose counts are those of base plus
+// deltas.  Word topic-histograms of view are created when they are
+// accessed for the first time, and recorded in live.  reset releases
+// them into free, from which they are reused, so that the memory is
+// bounded by words accessed between resets, instead of growing to a
+// histogram per word, and reset costs O(K + #live) instead of O(V).
+type overlay struct {
+	base *Model
+	view *Model
+	live []*overlayHist // created since the last reset
+	free []*overlayHist // released by reset, with empty deltas
+}
+
+func newOverlay(base *Model) *overlay {
+	o := &overlay{
+		base: base,
+		view: &Model{
+			GlobalTopicHist: hist.NewDense(base.NumTopics()),
+			WordTopicHists:  make([]hist.Hist, base.VocabSize()),
+		},
+	}
+	o.view.newHist = o.newHist
+	o.reset()
+	return o
+}
+
+func (o *overlay) newHist(token int32) hist.Hist {
+	var h *overlayHist
+	if n := len(o.free); n > 0 {
+		h, o.free = o.free[n-1], o.free[:n-1]
+	} else {
+		h = &overlayHist{bases: o.base.WordTopicHists, delta: hist.NewSparse()}
+	}
+	h.word = token
+	o.live = append(o.live, h)
+	return h
+}
+
+// reset discards deltas, releases histograms of the view, and
+// synchronizes the view with base.
+func (o *overlay) reset() {
+	for _, h := range o.live {
+		for t := range h.delta {
+			delete(h.delta, t)
+		}
+		o.view.WordTopicHists[h.word] = nil
+	}
+	o.free = append(o.free, o.live...)
+	o.live = o.live[:0]
+	copy(o.view.GlobalTopicHist.(hist.Dense),
+		o.base.GlobalTopicHist.(hist.Dense))
+	o.view.TopicPrior = o.base.TopicPrior
+	o.view.TopicPriorSum = o.base.TopicPriorSum
+	o.view.WordPrior = o.base.WordPrior
+	o.view.WordPriorSum = o.base.WordPriorSum
+}
+
+// appendDeltas appends non-zero deltas to ds.
+func (o *overlay) appendDeltas(ds []wordTopicDelta) []wordTopicDelta {
+	for _, h := range o.live {
+		for t, c := range h.delta {
+			ds = append(ds, wordTopicDelta{h.word, t, c})
+		}
+	}
+	return ds
+}
+
+// overlayHist is a word topic-histogram whose counts are those of
+// bases[word], which might be nil, plus delta.  Updates go to delta
+// only.  It reads bases[word] on every access, as the base model might
+// create the histogram of word after overlayHist is created.
+type overlayHist struct {
+	bases []hist.Hist
+	word  int32
+	delta hist.Sparse
+}
+
+func (h *overlayHist) base() hist.Hist {
+	return h.bases[h.word]
+}
+
+func (h *overlayHist) At(topic int) int64 {
+	var c int64
+	if len(h.delta) > 0 {
+		c = h.delta[int32(topic)]
+	}
+	if b := h.base(); b != nil {
+		c += b.At(topic)
+	}
+	return c
+}
+
+func (h *overlayHist) Inc(topic, count int) {
+	h.add(int32(topic), int64(count))
+}
+
+func (h *overlayHist) Dec(topic, count int) {
+	if c := h.At(topic); c < int64(count) {
+		panic(fmt.Sprintf("existing count (%d) < delta count (%d)",
+			c, count))
+	}
+	h.add(int32(topic), -int64(count))
+}
+
+func (h *overlayHist) add(t int32, c int64) {
+	if c += h.delta[t]; c != 0 {
+		h.delta[t] = c
+	} else {
+		delete(h.delta, t)
+	}
+}
+
+func (h *overlayHist) Len() int {
+	n := 0
+	h.ForEach(func(int, int64) error { n++; return nil })
+	return n
+}
+
+// ForEach goes over non-zeros of base in the order of base.ForEach,
+// and then topics that are only in delta.
+func (h *overlayHist) ForEach(p func(topic int, count int64) error) error {
+	base := h.base()
+	if base != nil {
+		if e := base.ForEach(func(t int, c int64) error {
+			if c += h.delta[int32(t)]; c != 0 {
+				return p(t, c)
+			}
+			return nil
+		}); e != nil {
+			return e
+		}
+	}
+	for t, c := range h.delta {
+		if base == nil || base.At(int(t)) == 0 {
+			if e := p(int(t), c); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// AppendNonZeros appends non-zeros of base in the order of
+// base.AppendNonZeros, with their deltas added, and then topics that
+// are only in delta.
+func (h *overlayHist) AppendNonZeros(topics []int32, counts []int64) (
+	[]int32, []int64) {
+	base := h.base()
+	if base == nil {
+		for t, c := range h.delta {
+			topics = append(topics, t)
+			counts = append(counts, c)
+		}
+		return topics, counts
+	}
+
+	n := len(topics)
+	topics, counts = base.AppendNonZeros(topics, counts)
+	if len(h.delta) == 0 {
+		return topics, counts
+	}
+	matched := 0 // topics in both base and delta
+	j := n
+	for i := n; i < len(topics); i++ {
+		t, c := topics[i], counts[i]
+		if d, ok := h.delta[t]; ok {
+			matched++
+			c += d
+		}
+		if c != 0 { // Remove topics cancelled by delta.
+			topics[j], counts[j] = t, c
+			j++
+		}
+	}
+	topics, counts = topics[:j], counts[:j]
+
+	if matched < len(h.delta) {
+		for t, c := range h.delta {
+			if base.At(int(t)) == 0 {
+				topics = append(topics, t)
+				counts = append(counts, c)
+			}
+		}
+	}
+	return topics, counts
+}
+
+// Clone returns the sum of base and delta as a hist.Sparse.
+func (h *overlayHist) Clone() hist.Hist {
+	s := hist.NewSparse()
+	h.ForEach(func(t int, c int64) error {
+		s[int32(t)] = c
+		return nil
+	})
+	return s
+}
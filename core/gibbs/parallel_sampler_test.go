@@ -0,0 +1,215 @@
+package gibbs
+
+import (
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// recountModel returns a model with counts of topic assignments in
+// corpus.
+func recountModel(m *Model, corpus []*Document) *Model {
+	n := NewModel(m.NumTopics(), m.VocabSize(), 1, 1)
+	for _, d := range corpus {
+		d.ApplyToModel(n)
+	}
+	return n
+}
+
+// equalCounts returns if word topic-histograms of m and n have the
+// same non-zeros, regardless of their types.
+func equalCounts(m, n *Model) bool {
+	if !reflect.DeepEqual(m.GlobalTopicHist, n.GlobalTopicHist) {
+		return false
+	}
+	for w := range m.WordTopicHists {
+		a, b := hist.NewSparse(), hist.NewSparse()
+		if h := m.WordTopicHists[w]; h != nil {
+			h.ForEach(func(t int, c int64) error { a[int32(t)] = c; return nil })
+		}
+		if h := n.WordTopicHists[w]; h != nil {
+			h.ForEach(func(t int, c int64) error { b[int32(t)] = c; return nil })
+		}
+		if !a.Equal(b) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParallelSamplerIndependentOfWorkers(t *testing.T) {
+	for _, kernel := range []string{SparseLDAKernel, AliasKernel} {
+		var truth []*Document
+		for _, workers := range []int{1, 2, 5} {
+			m, corpus := createLargeKCorpusWithSize(20, 200, 40, 20)
+			p, e := NewParallelSampler(m, kernel, workers)
+			if e != nil {
+				t.Fatal(e)
+			}
+			for iter := 0; iter < 3; iter++ {
+				p.Sample(corpus, 8, func(d int) int64 {
+					return int64(iter*len(corpus) + d)
+				})
+			}
+			if !equalCounts(m, recountModel(m, corpus)) {
+				t.Errorf("%s %d workers: model inconsistent with corpus",
+					kernel, workers)
+			}
+			if truth == nil {
+				truth = corpus
+			} else if !reflect.DeepEqual(truth, corpus) {
+				t.Errorf("%s: %d workers sample differently", kernel, workers)
+			}
+		}
+	}
+}
+
+func TestNewParallelSamplerErrors(t *testing.T) {
+	m := CreateTestingModel()
+	if _, e := NewParallelSampler(m, SparseLDAKernel, 0); e == nil {
+		t.Errorf("Expecting error for 0 workers")
+	}
+	if _, e := NewParallelSampler(m, "unknown", 1); e == nil {
+		t.Errorf("Expecting error for unknown kernel")
+	}
+}
+
+func TestOverlayHist(t *testing.T) {
+	for _, base := range []hist.Hist{nil, hist.Sparse{1: 2, 3: 1},
+		hist.NewPacked().AssignSparse(hist.Sparse{1: 2, 3: 1})} {
+		h := &overlayHist{bases: []hist.Hist{base}, delta: hist.NewSparse()}
+		truth := hist.NewSparse()
+		if base != nil {
+			truth = hist.Sparse{1: 2, 3: 1}
+		}
+		rng := rand.New(rand.NewSource(-1))
+		for i := 0; i < 1000; i++ {
+			topic := rng.Intn(6)
+			if truth[int32(topic)] > 0 && rng.Intn(2) == 0 {
+				h.Dec(topic, 1)
+				truth.Dec(topic, 1)
+			} else {
+				h.Inc(topic, 1)
+				truth.Inc(topic, 1)
+			}
+			if c := h.Clone().(hist.Sparse); !c.Equal(truth) {
+				t.Fatalf("%v: expecting %v, got %v", base, truth, c)
+			}
+			topics, counts := h.AppendNonZeros(nil, nil)
+			hist.SortByTopic(topics, counts)
+			o := hist.NewPacked().AssignSparse(truth)
+			if s := fmt.Sprint(o); s != fmt.Sprint(pairs(topics, counts)) {
+				t.Fatalf("%v: expecting %s, got %v %v", base, s, topics, counts)
+			}
+			if h.Len() != truth.Len() {
+				t.Fatalf("Expecting Len %d, got %d", truth.Len(), h.Len())
+			}
+		}
+	}
+}
+
+func TestOverlayReset(t *testing.T) {
+	o := newOverlay(CreateTestingModel())
+	o.view.WordTopicHist(0).Inc(1, 1)
+	o.view.WordTopicHist(2)
+	if len(o.live) != 2 {
+		t.Fatalf("Expecting 2 live histograms, got %d", len(o.live))
+	}
+	o.reset()
+	for w, h := range o.view.WordTopicHists {
+		if h != nil {
+			t.Errorf("Expecting histogram of word %d released", w)
+		}
+	}
+	if len(o.live) != 0 || len(o.free) != 2 {
+		t.Errorf("Expecting 0 live and 2 free, got %d and %d",
+			len(o.live), len(o.free))
+	}
+	h := o.view.WordTopicHist(3).(*overlayHist)
+	if len(o.free) != 1 || h.word != 3 || len(h.delta) != 0 {
+		t.Errorf("Expecting a reused histogram of word 3 without deltas, "+
+			"got word %d delta %v, %d free", h.word, h.delta, len(o.free))
+	}
+}
+
+func pairs(topics []int32, counts []int64) string {
+	out := "[ "
+	for i, t := range topics {
+		out += fmt.Sprintf("%d:%d ", t, counts[i])
+	}
+	return out + "]"
+}
+
+// BenchmarkParallelSamplerLargeK reports the throughput and the heap
+// used in addition to the model, which would be a model per worker if
+// workers sample cloned models.
+func BenchmarkParallelSamplerLargeK(b *testing.B) {
+	m, corpus := createLargeKCorpus()
+	workers := runtime.GOMAXPROCS(0)
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	p, e := NewParallelSampler(m, SparseLDAKernel, workers)
+	if e != nil {
+		b.Fatal(e)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Sample(corpus, 4*workers, func(d int) int64 { return int64(d) })
+	}
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(b.N*len(corpus)*len(corpus[0].Words))/
+		b.Elapsed().Seconds(), "tokens/s")
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc)),
+		"extra-heap-bytes")
+	runtime.KeepAlive(p)
+}
+
+// BenchmarkParallelSamplerSpeedupLargeK reports the speedup of
+// ParallelSampler with GOMAXPROCS workers over the serial Sampler, and
+// fails if the speedup is less than half of the number of workers
+// that can run simultaneously.
+func BenchmarkParallelSamplerSpeedupLargeK(b *testing.B) {
+	workers := runtime.GOMAXPROCS(0)
+	m, corpus := createLargeKCorpus()
+	s, e := NewKernel(SparseLDAKernel, m)
+	if e != nil {
+		b.Fatal(e)
+	}
+	pm, pcorpus := createLargeKCorpus()
+	p, e := NewParallelSampler(pm, SparseLDAKernel, workers)
+	if e != nil {
+		b.Fatal(e)
+	}
+	rng := rand.New(rand.NewSource(-1))
+
+	var serial, parallel time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		for _, d := range corpus {
+			s.Sample(d, rng)
+		}
+		serial += time.Since(start)
+
+		start = time.Now()
+		p.Sample(pcorpus, 4*workers, func(d int) int64 { return int64(d) })
+		parallel += time.Since(start)
+	}
+	speedup := serial.Seconds() / parallel.Seconds()
+	b.ReportMetric(speedup, "speedup")
+	cpus := workers
+	if cpus > runtime.NumCPU() {
+		cpus = runtime.NumCPU()
+	}
+	if speedup < 0.5*float64(cpus) {
+		b.Errorf("Speedup %f with %d workers on %d CPUs, less than %f",
+			speedup, workers, cpus, 0.5*float64(cpus))
+	}
+}
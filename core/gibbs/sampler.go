@@ -1,7 +1,7 @@
 package gibbs
 
 import (
-	"errors"
+	"github.com/wangkuiyi/phoenix/core/hist"
 	"log"
 	"math/rand"
 )
@@ -10,21 +10,30 @@ import (
 // the paper *Topic Model Inference on Streaming Document Collections*
 // by Limin Yao, David Mimno, and Andrew McCallum at KDD in 2009.
 // This algorithm supports the use of an asymmetric Dirichlet prior.
+//
+// The cost of sampling a token is proportional to the number of
+// non-zeros in the word's and the document's topic histograms, but
+// not to the number of topics K, except for the rare case that a
+// draw falls in the smoothing-only bucket, which costs O(log K).
 type Sampler struct {
 	model                      *Model
 	diff                       *Model
 	smoothingOnlyBucketSize    float64 // equation (7)
 	smoothingOnlyBucketFactors []float64
+	smoothingOnlyTree          fenwickTree
+	smoothingOnlyTreeUpdates   int
 	documentTopicBucketSize    float64 // equation (8)
 	documentTopicBucketFactors []float64
 	topicWordBucketSize        float64 // equation (9)
 	topicWordBucketFactors     []float64
+	topicWordBucketTopics      []int32   // in ascending order
+	topicWordBucketCounts      []int64   // counts of topicWordBucketTopics
 	coefficients               []float64 // part of equation (10)
 }
 
 func NewSampler(m *Model) *Sampler {
 	s := &Sampler{
-		model: m,
+		model:                      m,
 		smoothingOnlyBucketSize:    0,
 		smoothingOnlyBucketFactors: make([]float64, m.NumTopics()),
 		documentTopicBucketSize:    0,
@@ -68,13 +77,26 @@ func (s *Sampler) buildSmoothingOnlyBucket() {
 				(s.model.WordPriorSum + float64(s.model.GlobalTopicHist.At(t)))
 		s.smoothingOnlyBucketSize += s.smoothingOnlyBucketFactors[t]
 	}
+	s.buildSmoothingOnlyTree()
 }
 
+// buildSmoothingOnlyTree rebuilds s.smoothingOnlyTree from
+// s.smoothingOnlyBucketFactors.  As neglectOrConsiderWord updates the
+// tree incrementally, we rebuild it after every K updates, so
+// rounding errors do not accumulate, and the amortized cost of
+// rebuilding is O(1) per update.
+func (s *Sampler) buildSmoothingOnlyTree() {
+	s.smoothingOnlyTree.build(s.smoothingOnlyBucketFactors)
+	s.smoothingOnlyTreeUpdates = 0
+}
+
+// buildDocumentTopicBucket requires that all elements of
+// s.documentTopicBucketFactors are zeros, which is true for a new
+// Sampler and is restored by resetDocumentTopicBucket after sampling
+// each document.  This saves us from clearing K elements per
+// document.
 func (s *Sampler) buildDocumentTopicBucket(doc *Document) {
 	s.documentTopicBucketSize = 0
-	for t := range s.documentTopicBucketFactors {
-		s.documentTopicBucketFactors[t] = 0
-	}
 	for i := 0; i < doc.TopicHist.Len(); i++ {
 		t := int(doc.TopicHist.Topics[i])
 		s.documentTopicBucketFactors[t] =
@@ -84,19 +106,36 @@ func (s *Sampler) buildDocumentTopicBucket(doc *Document) {
 	}
 }
 
+// resetDocumentTopicBucket zeros the elements of
+// s.documentTopicBucketFactors that correspond to topics in doc.
+func (s *Sampler) resetDocumentTopicBucket(doc *Document) {
+	for i := 0; i < doc.TopicHist.Len(); i++ {
+		s.documentTopicBucketFactors[doc.TopicHist.Topics[i]] = 0
+	}
+	s.documentTopicBucketSize = 0
+}
+
 // buildTopicWordBucket assumes that cacheCoefficients had been called
-// to fill s.coefficients.
+// to fill s.coefficients.  It updates only elements of
+// s.topicWordBucketFactors that correspond to topics in the word's
+// histogram.  Other elements might keep values of other words, but
+// sampleNewTopic never reads them.  These topics are recorded in
+// s.topicWordBucketTopics in ascending order, so that sampleNewTopic
+// does not depend on the iteration order of the histogram, which is
+// random for hist.Sparse, and Gibbs sampling is reproducible.  It
+// reuses s.topicWordBucketTopics and s.topicWordBucketCounts, so it
+// does not allocate once they are large enough.
 func (s *Sampler) buildTopicWordBucket(token int32) {
 	s.topicWordBucketSize = 0
-	for t := range s.topicWordBucketFactors {
-		s.topicWordBucketFactors[t] = 0
-	}
-	h := s.model.WordTopicHist(token)
-	h.ForEach(func(t int, c int64) error {
-		s.topicWordBucketFactors[t] = s.coefficients[t] * float64(c)
+	s.topicWordBucketTopics, s.topicWordBucketCounts =
+		s.model.WordTopicHist(token).AppendNonZeros(
+			s.topicWordBucketTopics[:0], s.topicWordBucketCounts[:0])
+	hist.SortByTopic(s.topicWordBucketTopics, s.topicWordBucketCounts)
+	for i, t := range s.topicWordBucketTopics {
+		s.topicWordBucketFactors[t] =
+			s.coefficients[t] * float64(s.topicWordBucketCounts[i])
 		s.topicWordBucketSize += s.topicWordBucketFactors[t]
-		return nil
-	})
+	}
 }
 
 // cacheCoefficients computes only the smoothing part of equation
@@ -160,6 +199,7 @@ func (s *Sampler) neglectOrConsiderWord(
 
 	s.smoothingOnlyBucketSize -= s.smoothingOnlyBucketFactors[topic]
 	s.documentTopicBucketSize -= s.documentTopicBucketFactors[topic]
+	oldSmoothingOnlyFactor := s.smoothingOnlyBucketFactors[topic]
 
 	docTopicCount := float64(doc.TopicHist.At(t))
 	globalTopicCount := float64(s.model.GlobalTopicHist.At(t))
@@ -167,6 +207,13 @@ func (s *Sampler) neglectOrConsiderWord(
 	s.smoothingOnlyBucketFactors[topic] =
 		s.model.TopicPrior[topic] * s.model.WordPrior /
 			(s.model.WordPriorSum + globalTopicCount)
+	if s.smoothingOnlyTreeUpdates++; s.smoothingOnlyTreeUpdates >=
+		len(s.smoothingOnlyBucketFactors) {
+		s.buildSmoothingOnlyTree()
+	} else {
+		s.smoothingOnlyTree.add(t,
+			s.smoothingOnlyBucketFactors[topic]-oldSmoothingOnlyFactor)
+	}
 	s.documentTopicBucketFactors[topic] =
 		docTopicCount * s.model.WordPrior /
 			(s.model.WordPriorSum + globalTopicCount)
@@ -187,14 +234,13 @@ func (s *Sampler) sampleNewTopic(doc *Document, token int32,
 	var newTopic int32 = -1
 
 	if draw < s.topicWordBucketSize {
-		s.model.WordTopicHist(token).ForEach(func(topic int, _ int64) error {
+		for _, topic := range s.topicWordBucketTopics {
 			draw -= s.topicWordBucketFactors[topic]
 			if draw <= 0 {
-				newTopic = int32(topic)
-				return errors.New("break")
+				newTopic = topic
+				break
 			}
-			return nil
-		})
+		}
 	} else {
 		draw -= s.topicWordBucketSize
 		if draw < s.documentTopicBucketSize {
@@ -208,13 +254,7 @@ func (s *Sampler) sampleNewTopic(doc *Document, token int32,
 			}
 		} else {
 			draw -= s.documentTopicBucketSize
-			var i int32
-			draw -= s.smoothingOnlyBucketFactors[i]
-			for draw > 0 {
-				i++
-				draw -= s.smoothingOnlyBucketFactors[i]
-			}
-			newTopic = i
+			newTopic = int32(s.smoothingOnlyTree.search(draw))
 		}
 	}
 
@@ -238,4 +278,5 @@ func (s *Sampler) Sample(doc *Document, rng *rand.Rand) {
 		s.neglectOrConsiderWord(doc, token, newTopic, false)
 	}
 	s.resetCoefficients(doc)
+	s.resetDocumentTopicBucket(doc)
 }
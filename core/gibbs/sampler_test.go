@@ -1,10 +1,13 @@
 package gibbs
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"github.com/wangkuiyi/phoenix/core/hist"
 	"math/rand"
 	"reflect"
+	"runtime"
 	"testing"
 )
 
@@ -161,6 +164,68 @@ func TestSamplerSample(t *testing.T) {
 	}
 }
 
+// TestSamplerSamplePacked checks that Sampler is reproducible with
+// hist.Packed word topic-histograms.
+func TestSamplerSamplePacked(t *testing.T) {
+	m1, corpus1 := createLargeKCorpusWithSize(100, 1000, 50, 20)
+	m2, corpus2 := createLargeKCorpusWithSize(100, 1000, 50, 20)
+	m2.Pack()
+	s1, s2 := NewSampler(m1), NewSampler(m2)
+	rng1, rng2 := rand.New(rand.NewSource(-1)), rand.New(rand.NewSource(-1))
+	for iter := 0; iter < 5; iter++ {
+		for i := range corpus1 {
+			s1.Sample(corpus1[i], rng1)
+			s2.Sample(corpus2[i], rng2)
+		}
+	}
+	if !reflect.DeepEqual(corpus1, corpus2) {
+		t.Errorf("Expecting the same topic assignments")
+	}
+	for w, h := range m1.WordTopicHists {
+		if h != nil && h.Len() > 0 &&
+			sprint(h) != sprint(hist.NewSparse().AssignOrdered(
+				hist.NewOrderedSparse().Assign(m2.WordTopicHists[w]))) {
+			t.Errorf("Word %d: expecting %v, got %v",
+				w, h, m2.WordTopicHists[w])
+		}
+	}
+}
+
+// TestSamplerSampleAllocs checks that, once buffers grow large enough,
+// Sampler.Sample and Evaluator.Perplexity do not allocate.
+func TestSamplerSampleAllocs(t *testing.T) {
+	for _, pack := range []bool{false, true} {
+		m, corpus := createLargeKCorpusWithSize(100, 1000, 50, 20)
+		if pack {
+			m.Pack()
+		}
+		s := NewSampler(m)
+		rng := rand.New(rand.NewSource(-1))
+		sweep := func() {
+			for _, d := range corpus {
+				s.Sample(d, rng)
+			}
+		}
+		for iter := 0; iter < 5; iter++ {
+			sweep()
+		}
+		if a := testing.AllocsPerRun(10, sweep); a > 0 {
+			t.Errorf("Packed %v: expecting no allocation, got %f per sweep",
+				pack, a)
+		}
+
+		e := NewEvaluator(m, 0, s)
+		if a := testing.AllocsPerRun(10, func() {
+			for _, d := range corpus {
+				e.Perplexity(d)
+			}
+		}); a > 0 {
+			t.Errorf("Packed %v: expecting no allocation in evaluation, "+
+				"got %f", pack, a)
+		}
+	}
+}
+
 func TestSamplerDiff(t *testing.T) {
 	v, e := CreateTestingVocabulary()
 	if e != nil {
@@ -195,3 +260,118 @@ func TestSamplerDiff(t *testing.T) {
 		t.Errorf("model does not equal to diff. Model:\n%v\nDiff:\n%v", *m, *d)
 	}
 }
+
+const (
+	benchmarkLargeK      = 100000
+	benchmarkLargeV      = 10000
+	benchmarkLargeDocs   = 1000
+	benchmarkLargeDocLen = 100
+)
+
+// createLargeKCorpus creates a model with benchmarkLargeK topics and a
+// corpus of random documents applied to it.  Words follow a skewed
+// distribution, so frequent words spread over many topics as in real
+// corpora.
+func createLargeKCorpus() (*Model, []*Document) {
+	return createLargeKCorpusWithSize(benchmarkLargeK, benchmarkLargeV,
+		benchmarkLargeDocs, benchmarkLargeDocLen)
+}
+
+func createLargeKCorpusWithSize(k, v, docs, docLen int) (
+	*Model, []*Document) {
+	rng := rand.New(rand.NewSource(-1))
+	m := NewModel(k, v, 0.01, 0.01)
+	corpus := make([]*Document, docs)
+	for i := range corpus {
+		d := &Document{
+			TopicHist: hist.NewOrderedSparseAndReserve(docLen),
+			Words:     make([]int32, docLen),
+			Topics:    make([]int32, docLen),
+		}
+		for j := range d.Words {
+			d.Words[j] = int32(rng.Intn(rng.Intn(v) + 1))
+			d.Topics[j] = int32(rng.Intn(k))
+			d.TopicHist.Inc(int(d.Topics[j]), 1)
+		}
+		d.ApplyToModel(m)
+		corpus[i] = d
+	}
+	return m, corpus
+}
+
+func BenchmarkNewSamplerLargeK(b *testing.B) {
+	m, _ := createLargeKCorpus()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewSampler(m)
+	}
+}
+
+func benchmarkKernelLargeK(b *testing.B, kernel string) {
+	m, corpus := createLargeKCorpus()
+	benchmarkKernel(b, kernel, m, corpus)
+}
+
+func benchmarkKernel(b *testing.B, kernel string, m *Model,
+	corpus []*Document) {
+	s, e := NewKernel(kernel, m)
+	if e != nil {
+		b.Fatal(e)
+	}
+	rng := rand.New(rand.NewSource(-1))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, d := range corpus {
+			s.Sample(d, rng)
+		}
+	}
+	b.ReportMetric(float64(b.N*len(corpus)*len(corpus[0].Words))/
+		b.Elapsed().Seconds(), "tokens/s")
+}
+
+func BenchmarkSamplerSampleLargeK(b *testing.B) {
+	benchmarkKernelLargeK(b, SparseLDAKernel)
+}
+
+func BenchmarkSamplerSamplePackedLargeK(b *testing.B) {
+	m, corpus := createLargeKCorpus()
+	m.Pack()
+	benchmarkKernel(b, SparseLDAKernel, m, corpus)
+}
+
+// benchmarkModelMemory reports heap and gob bytes of word
+// topic-histograms of the large-K model.
+func benchmarkModelMemory(b *testing.B, pack bool) {
+	var heap, enc int
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		m, _ := createLargeKCorpus()
+		if pack {
+			m.Pack()
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap = int(after.HeapAlloc) - int(before.HeapAlloc)
+
+		var buf bytes.Buffer
+		if e := gob.NewEncoder(&buf).Encode(m); e != nil {
+			b.Fatal(e)
+		}
+		enc = buf.Len()
+		runtime.KeepAlive(m)
+	}
+	b.ReportMetric(float64(heap), "heap-bytes")
+	b.ReportMetric(float64(enc), "gob-bytes")
+}
+
+func BenchmarkModelMemorySparseLargeK(b *testing.B) {
+	benchmarkModelMemory(b, false)
+}
+
+func BenchmarkModelMemoryPackedLargeK(b *testing.B) {
+	benchmarkModelMemory(b, true)
+}
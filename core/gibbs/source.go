@@ -0,0 +1,31 @@
+package gibbs
+
+// Source is a rand.Source64 implementing the SplitMix64 algorithm.
+// Unlike the source returned by rand.NewSource, its state is a single
+// exported integer, so it can be saved into and restored from
+// checkpoints, and a restored Source generates exactly the same
+// sequence as the saved one would.  Seeding it is also much cheaper,
+// which matters when it is re-seeded for each document.
+type Source struct {
+	State uint64
+}
+
+func NewSource(seed int64) *Source {
+	return &Source{uint64(seed)}
+}
+
+func (s *Source) Seed(seed int64) {
+	s.State = uint64(seed)
+}
+
+func (s *Source) Uint64() uint64 {
+	s.State += 0x9e3779b97f4a7c15
+	z := s.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
@@ -0,0 +1,139 @@
+package gibbs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"io"
+	"sort"
+)
+
+// ThetaAccumulator accumulates topic assignments of a corpus over
+// Gibbs sampling iterations, and computes the averaged topic
+// distribution (theta) of each document, smoothed by the topic prior:
+/*
+                n_dk + a_k
+   theta_dk = ----------------
+              L_d + \sum_k a_k
+*/
+// where n_dk is averaged over accumulated iterations.
+type ThetaAccumulator struct {
+	hists   []hist.Sparse
+	samples int
+}
+
+func NewThetaAccumulator(docs int) *ThetaAccumulator {
+	return &ThetaAccumulator{hists: make([]hist.Sparse, docs)}
+}
+
+// Samples returns the number of accumulated iterations.
+func (a *ThetaAccumulator) Samples() int {
+	return a.samples
+}
+
+// Add accumulates current topic assignments of corpus, which must
+// have as many documents as NewThetaAccumulator was given.
+func (a *ThetaAccumulator) Add(corpus []*Document) {
+	if len(corpus) != len(a.hists) {
+		panic(fmt.Sprintf("corpus has %d documents, expecting %d",
+			len(corpus), len(a.hists)))
+	}
+	for i, d := range corpus {
+		if a.hists[i] == nil {
+			a.hists[i] = hist.NewSparse()
+		}
+		h := a.hists[i]
+		d.TopicHist.ForEach(func(topic int, count int64) error {
+			h.Inc(topic, int(count))
+			return nil
+		})
+	}
+	a.samples++
+}
+
+// Theta returns the averaged theta of the d-th document.  To keep it
+// sparse, the returned distribution includes only topics assigned to
+// the document.  The probability of any other topic k is a_k/(L_d +
+// \sum_k a_k), which is not included.
+func (a *ThetaAccumulator) Theta(d int, m *Model) SparseDist {
+	h := a.hists[d]
+	if h == nil || a.samples <= 0 {
+		return nil
+	}
+	n := float64(a.samples)
+	var length float64
+	h.ForEach(func(_ int, count int64) error {
+		length += float64(count) / n
+		return nil
+	})
+	return smoothedTheta(h, n, length, m.TopicPrior, m.TopicPriorSum)
+}
+
+// Theta returns the topic distribution of d given its current topic
+// assignments, as ThetaAccumulator.Theta does with a single sample.
+func (d *Document) Theta(topicPrior []float64, topicPriorSum float64) SparseDist {
+	return smoothedTheta(d.TopicHist, 1, float64(d.Len()),
+		topicPrior, topicPriorSum)
+}
+
+func smoothedTheta(h hist.Hist, samples, length float64,
+	topicPrior []float64, topicPriorSum float64) SparseDist {
+	theta := make(SparseDist, 0, h.Len())
+	h.ForEach(func(topic int, count int64) error {
+		if count > 0 {
+			theta = append(theta, Prob{int32(topic),
+				(float64(count)/samples + topicPrior[topic]) /
+					(length + topicPriorSum)})
+		}
+		return nil
+	})
+	// Sort by topic first so that topics with the same probability
+	// are in deterministic order.
+	sort.Sort(byTopic(theta))
+	sort.Stable(theta)
+	return theta
+}
+
+type byTopic SparseDist
+
+func (a byTopic) Len() int           { return len(a) }
+func (a byTopic) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byTopic) Less(i, j int) bool { return a[i].Topic < a[j].Topic }
+
+// WriteTheta writes theta as a line, which consists of key and
+// space-separated topic:probability pairs.
+func WriteTheta(w io.Writer, key string, theta SparseDist) error {
+	var b bytes.Buffer
+	b.WriteString(key)
+	for _, p := range theta {
+		fmt.Fprintf(&b, " %d:%g", p.Topic, p.Prob)
+	}
+	b.WriteByte('\n')
+	_, e := w.Write(b.Bytes())
+	return e
+}
+
+// thetaAccumulatorGob mirrors ThetaAccumulator with exported fields
+// for gob.
+type thetaAccumulatorGob struct {
+	Hists   []hist.Sparse
+	Samples int
+}
+
+// GobEncode allows ThetaAccumulator to be saved into checkpoints.
+func (a *ThetaAccumulator) GobEncode() ([]byte, error) {
+	var b bytes.Buffer
+	e := gob.NewEncoder(&b).Encode(&thetaAccumulatorGob{a.hists, a.samples})
+	return b.Bytes(), e
+}
+
+func (a *ThetaAccumulator) GobDecode(data []byte) error {
+	var g thetaAccumulatorGob
+	if e := gob.NewDecoder(bytes.NewReader(data)).Decode(&g); e != nil {
+		return e
+	}
+	a.hists = g.Hists
+	a.samples = g.Samples
+	return nil
+}
@@ -0,0 +1,54 @@
+package gibbs
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestDocumentTheta(t *testing.T) {
+	v, _ := CreateTestingVocabulary()
+	d := CreateTestingDocument(v) // two tokens, both in topic 1
+	m := CreateTestingModel()
+	truth := "[{1 0.9545454545454545}]" // (2+0.1)/(2+0.2)
+	if s := fmt.Sprint(d.Theta(m.TopicPrior, m.TopicPriorSum)); s != truth {
+		t.Errorf("Expecting %s, got %s", truth, s)
+	}
+}
+
+func TestThetaAccumulator(t *testing.T) {
+	v, _ := CreateTestingVocabulary()
+	m := CreateTestingModel()
+	rng := rand.New(rand.NewSource(-1))
+	d := InitializeDocument([]string{"apple", "orange"}, v, testingK, rng)
+	corpus := []*Document{d}
+
+	a := NewThetaAccumulator(len(corpus))
+	setTopics(d, 0, 0)
+	a.Add(corpus)
+	setTopics(d, 0, 1)
+	a.Add(corpus)
+
+	// n_d0 = 1.5, n_d1 = 0.5
+	truth := "[{0 0.7272727272727273} {1 0.2727272727272727}]"
+	if s := fmt.Sprint(a.Theta(0, m)); s != truth {
+		t.Errorf("Expecting %s, got %s", truth, s)
+	}
+
+	var b bytes.Buffer
+	if e := WriteTheta(&b, "0", a.Theta(0, m)); e != nil {
+		t.Fatal(e)
+	}
+	if s := b.String(); s != "0 0:0.7272727272727273 1:0.2727272727272727\n" {
+		t.Errorf("Unexpected output %q", s)
+	}
+}
+
+func setTopics(d *Document, topics ...int32) {
+	for i, topic := range topics {
+		d.TopicHist.Dec(int(d.Topics[i]), 1)
+		d.Topics[i] = topic
+		d.TopicHist.Inc(int(topic), 1)
+	}
+}
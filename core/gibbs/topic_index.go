@@ -0,0 +1,86 @@
+package gibbs
+
+import (
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"sort"
+)
+
+// TopicIndex is an inverted index from topics to words.  For each
+// topic, it holds words and their counts in descending order of
+// counts, as returned by Model.GetTopWords.  Model.GetTopWords walks
+// histograms of all words for a topic, so querying all topics costs
+// O(K x V x nnz).  In contrast, NewTopicIndex walks histograms only
+// once, and querying a topic costs O(1).
+//
+// TopicIndex is a snapshot of the model, and is not updated with the
+// model.  Histograms returned by its methods are shared by the index,
+// and must not be modified.
+type TopicIndex struct {
+	words  []*hist.OrderedSparse // nil for topics without words
+	totals []int64               // GlobalTopicHist when built
+}
+
+func NewTopicIndex(m *Model) *TopicIndex {
+	x := &TopicIndex{
+		words:  make([]*hist.OrderedSparse, m.NumTopics()),
+		totals: make([]int64, m.NumTopics()),
+	}
+	for word, h := range m.WordTopicHists {
+		if h != nil {
+			h.ForEach(func(t int, c int64) error {
+				if c > 0 {
+					o := x.words[t]
+					if o == nil {
+						o = hist.NewOrderedSparse()
+						x.words[t] = o
+					}
+					o.Topics = append(o.Topics, int32(word))
+					o.Counts = append(o.Counts, c)
+				}
+				return nil
+			})
+		}
+	}
+	for t, o := range x.words {
+		if o != nil {
+			sort.Sort(o)
+		}
+		x.totals[t] = m.GlobalTopicHist.At(t)
+	}
+	return x
+}
+
+func (x *TopicIndex) NumTopics() int {
+	return len(x.words)
+}
+
+// TopWords returns words of topic and their counts, in descending
+// order of counts, or nil if the topic has no word.
+func (x *TopicIndex) TopWords(topic int) *hist.OrderedSparse {
+	return x.words[topic]
+}
+
+// TopNWords returns the top words of topic whose counts accumulate to
+// percentage of the size of the topic, like Model.GetTopNWords.
+func (x *TopicIndex) TopNWords(topic int, percentage float64) *hist.OrderedSparse {
+	if o := x.words[topic]; o != nil {
+		return truncateTopWords(o, x.totals[topic], percentage)
+	}
+	return nil
+}
+
+// truncateTopWords returns a prefix of o whose counts accumulate to
+// percentage of total.  The prefix shares the content with o.
+func truncateTopWords(o *hist.OrderedSparse, total int64,
+	percentage float64) *hist.OrderedSparse {
+	var accum int
+	for i := 0; i < o.Len(); i++ {
+		accum += int(o.Counts[i])
+		if accum >= int(float64(total)*percentage) {
+			return &hist.OrderedSparse{
+				Topics: o.Topics[0 : i+1],
+				Counts: o.Counts[0 : i+1]}
+		}
+	}
+	return o
+}
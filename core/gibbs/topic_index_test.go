@@ -0,0 +1,75 @@
+package gibbs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopicIndex(t *testing.T) {
+	for _, m := range []*Model{CreateTestingModel(), createTopicIndexModel()} {
+		x := NewTopicIndex(m)
+		if x.NumTopics() != m.NumTopics() {
+			t.Errorf("Expecting %d topics. Got %d", m.NumTopics(), x.NumTopics())
+		}
+		for topic := 0; topic < m.NumTopics(); topic++ {
+			if h := m.GetTopWords(topic); h == nil {
+				if o := x.TopWords(topic); o != nil {
+					t.Errorf("Expecting nil for topic %d. Got %v", topic, o)
+				}
+			} else if !reflect.DeepEqual(h, x.TopWords(topic)) {
+				t.Errorf("Topic %d: expecting %v. Got %v",
+					topic, h, x.TopWords(topic))
+			}
+			for _, pct := range []float64{0.1, 0.5, 1.0} {
+				h := m.GetTopNWords(topic, pct)
+				o := x.TopNWords(topic, pct)
+				if (h == nil) != (o == nil) ||
+					h != nil && !reflect.DeepEqual(h, o) {
+					t.Errorf("Topic %d pct %f: expecting %v. Got %v",
+						topic, pct, h, o)
+				}
+			}
+		}
+	}
+}
+
+// createTopicIndexModel creates a model with ties in word counts and
+// empty topics.
+func createTopicIndexModel() *Model {
+	m := NewModel(5, 20, 0.01, 0.01)
+	for w := 0; w < 20; w++ {
+		for t := 0; t < 3; t++ {
+			if c := (w*7 + t*3) % 4; c > 0 {
+				m.WordTopicHist(int32(w)).Inc(t, c)
+				m.GlobalTopicHist.Inc(t, c)
+			}
+		}
+	}
+	return m
+}
+
+// BenchmarkGetTopWordsLargeK measures the cost of querying a topic by
+// walking the model.  Describing all topics costs benchmarkLargeK
+// times of it.
+func BenchmarkGetTopWordsLargeK(b *testing.B) {
+	m, _ := createLargeKCorpus()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.GetTopWords(i % benchmarkLargeK)
+	}
+}
+
+// BenchmarkTopicIndexLargeK measures the cost of building the index
+// and querying all topics.
+func BenchmarkTopicIndexLargeK(b *testing.B) {
+	m, _ := createLargeKCorpus()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x := NewTopicIndex(m)
+		for t := 0; t < benchmarkLargeK; t++ {
+			x.TopWords(t)
+		}
+	}
+}
@@ -77,11 +77,22 @@ func (v *Vocabulary) Swap(i, j int) {
 	v.Tokens[i], v.Tokens[j] = v.Tokens[j], v.Tokens[i]
 }
 
+// Token is the same as LookupToken, but panics if id is out of range.
 func (v *Vocabulary) Token(id int32) string {
+	t, e := v.LookupToken(id)
+	if e != nil {
+		panic(e.Error())
+	}
+	return t
+}
+
+// LookupToken returns the token of id, or an error if id is out of
+// range.
+func (v *Vocabulary) LookupToken(id int32) (string, error) {
 	if int(id) < 0 || int(id) >= len(v.Tokens) {
-		panic(fmt.Sprintf("id=%d out of range [0, %d)", id, len(v.Tokens)))
+		return "", fmt.Errorf("id=%d out of range [0, %d)", id, len(v.Tokens))
 	}
-	return v.Tokens[id]
+	return v.Tokens[id], nil
 }
 
 // Id returns the index of token.  If token is not in the vocabulary,
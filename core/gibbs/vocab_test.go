@@ -73,3 +73,13 @@ func TestVocabularyTokenAndId(t *testing.T) {
 		t.Errorf("Expecting v.Token(0) = \"tiger\", got %s", v.Token(1))
 	}
 }
+
+func TestVocabularyLookupToken(t *testing.T) {
+	v, _ := CreateTestingVocabulary()
+	if s, e := v.LookupToken(3); e != nil || s != "apple" {
+		t.Errorf("Expecting apple, got %s, %v", s, e)
+	}
+	if _, e := v.LookupToken(int32(v.Len())); e == nil {
+		t.Errorf("Expecting error for out of range id")
+	}
+}
@@ -1,9 +1,8 @@
 package heavy_tests
 
 import (
-	"bytes"
-	"fmt"
 	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/synth"
 	"math/rand"
 	"strings"
 	"testing"
@@ -22,17 +21,11 @@ var (
 	}
 	groundTruthVocab = "00\n01\n02\n10\n11\n12\n20\n21\n22"
 	groundTruthAlpha = []float64{0.6, 0.2, 0.3, 0.4, 0.5, 0.6}
-	groundTruthBeta  = 2
 	groundTruthK     = len(groundTruthAlpha)
 	groundTruthV     = len(groundTruthModel[0])
 
-	expectedModel = `Topic 0: 20 (548) 21 (534) 22 (495) 00 (53)
-Topic 1: 00 (747) 01 (738) 02 (716)
-Topic 2: 10 (524) 00 (510) 20 (458) 01 (50)
-Topic 3: 02 (862) 22 (828) 12 (721)
-Topic 4: 21 (593) 01 (587) 11 (515) 12 (3)
-Topic 5: 11 (408) 12 (310) 10 (300)
-`
+	// The minimum synth.Recovery score of the learned model.
+	expectedRecovery = 0.9
 )
 
 // In their paper "Finding Scientific Topics" on PNAS 2004, Thomas
@@ -50,10 +43,8 @@ Topic 5: 11 (408) 12 (310) 10 (300)
 //
 // In this program, we extend Griffith's method to consider an
 // asynmmetric Dirichlet prior \alpha and a symmetric Dirichlet prior
-// \beta.
-func testGriffith(t *testing.T) {
-	// TODO(wyi): Currently this test always fails. We need to find
-	// out why.
+// \beta, and we measure the similarity of images by synth.Recovery.
+func TestGriffith(t *testing.T) {
 	v := gibbs.NewVocabulary()
 	e := v.Load(strings.NewReader(groundTruthVocab))
 	if e != nil {
@@ -61,7 +52,13 @@ func testGriffith(t *testing.T) {
 	}
 
 	rng := rand.New(rand.NewSource(-1))
-	corpus := createGriffithTrainingData(v, rng)
+	g := createGriffithGroundTruth()
+	corpus := make([]*gibbs.Document, 0, groundTruthNumDoc)
+	for _, words := range g.Corpus(groundTruthNumDoc,
+		synth.FixedLen(groundTruthDocLen), rng) {
+		corpus = append(corpus,
+			gibbs.InitializeDocument(words, v, groundTruthK, rng))
+	}
 
 	m := gibbs.NewModel(groundTruthK, groundTruthV, kAlpha, kBeta)
 	for _, d := range corpus {
@@ -79,74 +76,33 @@ func testGriffith(t *testing.T) {
 		s.AfterOptimization()
 	}
 
-	w := new(bytes.Buffer)
-	m.PrintTopics(w, v)
-	// BUG(wyi) TODO(wyi): The following test fails.  Maybe due to bugs in
-	// func (m *Model) PrintTopics(w io.Writer, v *Vocabulary).
-	if w.String() != expectedModel {
-		t.Errorf("Expecting %v, got %v", expectedModel, w.String())
-	}
-}
-
-// createGriffithTrainingData samples synthetic training data from
-func createGriffithTrainingData(v *gibbs.Vocabulary,
-	rng *rand.Rand) []*gibbs.Document {
-
-	t := make([]int, groundTruthK)
-	d := make([]string, groundTruthDocLen)
-	r := make([]*gibbs.Document, groundTruthNumDoc)
-	for i := 0; i < groundTruthNumDoc; i++ {
-		sampleTopicHist(rng, t)
-		synthesizeDocument(t, rng, d)
-		r[i] = gibbs.InitializeDocument(d, v, groundTruthK, rng)
-	}
-	return r
-}
-
-func synthesizeDocument(topicHist []int, rng *rand.Rand, doc []string) {
-	doc = doc[0:0]
-	for t, c := range topicHist {
-		for i := 0; i < c; i++ {
-			doc = append(doc, word(sampleDiscrete(groundTruthModel[t], rng)))
-		}
-	}
-}
-
-func sampleTopicHist(rng *rand.Rand, hist []int) {
-	dist := make([]float64, groundTruthK)
-	copy(dist, groundTruthAlpha)
-	for i, _ := range hist {
-		hist[i] = 0
+	score, matching, e := synth.Recovery(g, m, v)
+	if e != nil {
+		t.Fatal(e)
 	}
-	for i := 0; i < groundTruthDocLen; i++ {
-		t := sampleDiscrete(dist, rng)
-		dist[t] += 1.0
-		hist[t]++
+	if score < expectedRecovery {
+		t.Errorf("Expecting recovery >= %f, got %f with matching %v",
+			expectedRecovery, score, matching)
 	}
 }
 
-func sampleDiscrete(dist []float64, rng *rand.Rand) int {
-	if len(dist) <= 0 {
-		panic("sample from empty distribution")
+// createGriffithGroundTruth normalizes groundTruthModel into word
+// distributions.
+func createGriffithGroundTruth() *synth.GroundTruth {
+	g := &synth.GroundTruth{
+		Tokens: strings.Split(groundTruthVocab, "\n"),
+		Alpha:  groundTruthAlpha,
+		Phi:    make([][]float64, groundTruthK),
 	}
-	sum := 0.0
-	for _, v := range dist {
-		if v < 0 {
-			panic(fmt.Sprintf("bad dist: %v", dist))
+	for k, bar := range groundTruthModel {
+		g.Phi[k] = make([]float64, groundTruthV)
+		sum := 0.0
+		for _, c := range bar {
+			sum += c
 		}
-		sum += v
-	}
-	u := rng.Float64() * sum
-	sum = 0
-	for i, v := range dist {
-		sum += v
-		if u < sum {
-			return i
+		for i, c := range bar {
+			g.Phi[k][i] = c / sum
 		}
 	}
-	panic("sampleDiscrete gets out of all possiblilities")
-}
-
-func word(sample int) string {
-	return fmt.Sprintf("%d%d", sample/3, sample%3)
+	return g
 }
@@ -52,6 +52,17 @@ func (d Dense) ForEach(p func(topic int, count int64) error) error {
 	return nil
 }
 
+func (d Dense) AppendNonZeros(topics []int32, counts []int64) (
+	[]int32, []int64) {
+	for i, v := range d {
+		if v != 0 {
+			topics = append(topics, int32(i))
+			counts = append(counts, v)
+		}
+	}
+	return topics, counts
+}
+
 func (d Dense) Clone() Hist {
 	n := NewDense(d.Len())
 	copy(n, d)
@@ -3,6 +3,6 @@
 // Use of this source code is governed by a BSD-style license that can
 // be found in the LICENSE file.
 
-// Package hist defines three kinds of topic histograms: Dense, Sparse
-// and OrderedSparse.
+// Package hist defines four kinds of topic histograms: Dense, Sparse,
+// OrderedSparse and Packed.
 package hist
@@ -12,5 +12,54 @@ type Hist interface {
 	// traversal and returns the error from p.
 	ForEach(p func(topic int, count int64) error) error
 
+	// AppendNonZeros appends topics and counts of non-zero elements,
+	// in the order of ForEach, to topics and counts, and returns the
+	// extended slices like append does.  Unlike ForEach, it does not
+	// allocate if the slices have enough capacity, and does not call
+	// closures, so it suits inner loops of sampling.
+	AppendNonZeros(topics []int32, counts []int64) ([]int32, []int64)
+
 	Clone() Hist
 }
+
+// SortByTopic sorts topics in ascending order, and reorders counts
+// accordingly, as returned by Hist.AppendNonZeros.  Unlike sort.Sort,
+// it does not allocate.
+func SortByTopic(topics []int32, counts []int64) {
+	sorted := true
+	for i := 1; i < len(topics) && sorted; i++ {
+		sorted = topics[i-1] <= topics[i]
+	}
+	if sorted {
+		return
+	}
+
+	// Heap sort.
+	n := len(topics)
+	for i := n/2 - 1; i >= 0; i-- {
+		siftDown(topics, counts, i, n)
+	}
+	for i := n - 1; i > 0; i-- {
+		topics[0], topics[i] = topics[i], topics[0]
+		counts[0], counts[i] = counts[i], counts[0]
+		siftDown(topics, counts, 0, i)
+	}
+}
+
+func siftDown(topics []int32, counts []int64, root, n int) {
+	for {
+		child := 2*root + 1
+		if child >= n {
+			return
+		}
+		if child+1 < n && topics[child] < topics[child+1] {
+			child++
+		}
+		if topics[root] >= topics[child] {
+			return
+		}
+		topics[root], topics[child] = topics[child], topics[root]
+		counts[root], counts[child] = counts[child], counts[root]
+		root = child
+	}
+}
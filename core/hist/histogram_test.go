@@ -3,6 +3,7 @@ package hist
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"testing"
 )
 
@@ -56,3 +57,50 @@ func TestOrderedSparseIsHist(t *testing.T) {
 		t.Errorf("%v", e)
 	}
 }
+
+func TestPackedIsHist(t *testing.T) {
+	var p Hist
+	p = NewPacked()
+	if e := ExampleHist(p, "0 1 ", t); e != nil {
+		t.Errorf("%v", e)
+	}
+}
+
+func TestAppendNonZeros(t *testing.T) {
+	for _, h := range []Hist{NewDense(5), NewSparse(), NewOrderedSparse(),
+		NewPacked()} {
+		h.Inc(3, 2)
+		h.Inc(1, 5)
+		h.Inc(4, 1)
+		topics, counts := h.AppendNonZeros([]int32{9}, []int64{9})
+		SortByTopic(topics[1:], counts[1:])
+		if s := fmt.Sprint(topics, counts); s != "[9 1 3 4] [9 5 2 1]" {
+			t.Errorf("%T: expecting [9 1 3 4] [9 5 2 1], got %s", h, s)
+		}
+	}
+}
+
+func TestSortByTopic(t *testing.T) {
+	rng := rand.New(rand.NewSource(-1))
+	for n := 0; n < 50; n++ {
+		ts, cs := make([]int32, n), make([]int64, n)
+		for i, p := range rng.Perm(n) {
+			ts[i] = int32(p)
+			cs[i] = int64(p * 10)
+		}
+		topics, counts := make([]int32, n), make([]int64, n)
+		if a := testing.AllocsPerRun(1, func() {
+			copy(topics, ts)
+			copy(counts, cs)
+			SortByTopic(topics, counts)
+		}); a > 0 {
+			t.Errorf("Expecting no allocation, got %f", a)
+		}
+		for i := range topics {
+			if topics[i] != int32(i) || counts[i] != int64(i*10) {
+				t.Errorf("n = %d: unsorted %v %v", n, topics, counts)
+				break
+			}
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 // represents document topic-histograms.
 type OrderedSparse struct {
 	Topics []int32
-	Counts []int32
+	Counts []int64
 }
 
 func NewOrderedSparse() *OrderedSparse {
@@ -27,7 +27,7 @@ func NewOrderedSparse() *OrderedSparse {
 func NewOrderedSparseAndReserve(cap int) *OrderedSparse {
 	return &OrderedSparse{
 		Topics: make([]int32, 0, cap),
-		Counts: make([]int32, 0, cap)}
+		Counts: make([]int64, 0, cap)}
 }
 
 // Len makes OrderedSparse compatible with sort.Interface.
@@ -54,10 +54,10 @@ func (o *OrderedSparse) Swap(i, j int) {
 // represents s.
 func (o *OrderedSparse) Assign(s Hist) *OrderedSparse {
 	o.Topics = make([]int32, 0, s.Len())
-	o.Counts = make([]int32, 0, s.Len())
+	o.Counts = make([]int64, 0, s.Len())
 	s.ForEach(func(topic int, count int64) error {
 		o.Topics = append(o.Topics, int32(topic))
-		o.Counts = append(o.Counts, int32(count))
+		o.Counts = append(o.Counts, count)
 		return nil
 	})
 	sort.Sort(o)
@@ -95,7 +95,7 @@ func (o OrderedSparse) String() string {
 func (o OrderedSparse) At(topic int) int64 {
 	for i := range o.Topics {
 		if int(o.Topics[i]) == topic {
-			return int64(o.Counts[i])
+			return o.Counts[i]
 		}
 	}
 	return 0
@@ -110,19 +110,16 @@ func (o *OrderedSparse) Inc(topic, count int) {
 	if count <= 0 {
 		panic(fmt.Sprintf("count (%d) <= 0", count))
 	}
-	if count > int(math.MaxInt32) {
-		panic(fmt.Sprintf("count (%d) larger than MaxInt32", count))
-	}
 
 	// Increase an exisitng non-zero or append one.
 	t := int32(topic)
-	c := int32(count)
+	c := int64(count)
 	var i int = 0
 	for i < len(o.Topics) && o.Topics[i] != t {
 		i++
 	}
 	if i < len(o.Topics) { // found
-		if o.Counts[i] >= math.MaxInt32-t {
+		if o.Counts[i] > math.MaxInt64-c {
 			panic(fmt.Sprintf("o[%d] = %d overflow", i, o.Counts[i]))
 		}
 		o.Counts[i] += c
@@ -153,7 +150,7 @@ func (o *OrderedSparse) Dec(topic, count int) {
 	}
 
 	t := int32(topic)
-	c := int32(count)
+	c := int64(count)
 	var i int = 0
 	for i < len(o.Topics) && o.Topics[i] != t {
 		i++
@@ -184,18 +181,23 @@ func (o *OrderedSparse) Dec(topic, count int) {
 // OrderedSparse.ForEach goes over elements in the order of descending count.
 func (o *OrderedSparse) ForEach(p func(topic int, count int64) error) error {
 	for i := 0; i < len(o.Topics); i++ {
-		if e := p(int(o.Topics[i]), int64(o.Counts[i])); e != nil {
+		if e := p(int(o.Topics[i]), o.Counts[i]); e != nil {
 			return e
 		}
 	}
 	return nil
 }
 
+func (o *OrderedSparse) AppendNonZeros(topics []int32, counts []int64) (
+	[]int32, []int64) {
+	return append(topics, o.Topics...), append(counts, o.Counts...)
+}
+
 // Clone creates a new OrderedSparse variable, makes it represents o.
 func (o *OrderedSparse) Clone() Hist {
 	n := NewOrderedSparse()
 	n.Topics = make([]int32, len(o.Topics))
-	n.Counts = make([]int32, len(o.Counts))
+	n.Counts = make([]int64, len(o.Counts))
 	copy(n.Topics, o.Topics)
 	copy(n.Counts, o.Counts)
 	return n
@@ -2,6 +2,7 @@ package hist
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -69,7 +70,7 @@ func TestOrderedSparseInc(t *testing.T) {
 				t.Errorf("Expecting m.Topics[%d] = %d, got %d",
 					i, nonzero-1-i, m.Topics[i])
 			}
-			if m.Counts[i] != 2*int32(nonzero-i) {
+			if m.Counts[i] != 2*int64(nonzero-i) {
 				t.Errorf("Expecting m.Counts[%d] = %d, got %d",
 					i, nonzero-i, m.Counts[i])
 			}
@@ -115,3 +116,20 @@ func TestOrderedSparseClone(t *testing.T) {
 		t.Errorf("Expected %d, got %d", 0, c.Len())
 	}
 }
+
+func TestOrderedSparseIncOverflow(t *testing.T) {
+	o := NewOrderedSparse()
+	o.Inc(5, math.MaxInt32)
+	o.Inc(5, math.MaxInt32)
+	if o.At(5) != 2*math.MaxInt32 {
+		t.Errorf("Expecting %d, got %d", int64(2*math.MaxInt32), o.At(5))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expecting panic on overflow")
+		}
+	}()
+	o.Counts[0] = math.MaxInt64 - 1
+	o.Inc(5, 2)
+}
@@ -0,0 +1,191 @@
+package hist
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sort"
+)
+
+// Packed represents a histogram as a slice of uint64s in ascending
+// order of topics, where each element packs a topic in the higher
+// packedTopicBits bits and its count in the lower packedCountBits
+// bits.  It costs 8 bytes per non-zero, much less than Sparse, so it
+// is an alternative of Sparse for word topic-histograms in large
+// models with less than MaxPackedTopics topics.  Inc and Dec locate
+// topics by binary search, and move elements only to insert or remove
+// a non-zero.
+type Packed struct {
+	Elems []uint64
+}
+
+const (
+	packedTopicBits = 24
+	packedCountBits = 64 - packedTopicBits
+
+	MaxPackedTopics = 1 << packedTopicBits
+	maxPackedCount  = 1<<packedCountBits - 1
+)
+
+func init() {
+	gob.Register(&Packed{})
+}
+
+func NewPacked() *Packed {
+	return &Packed{nil}
+}
+
+// AssignSparse clears p and makes it represents s.
+func (p *Packed) AssignSparse(s Sparse) *Packed {
+	p.Elems = make([]uint64, 0, len(s))
+	for t, c := range s {
+		checkPackedTopic(int(t))
+		if c > maxPackedCount {
+			panic(fmt.Sprintf("s[%d] = %d larger than %d",
+				t, c, int64(maxPackedCount)))
+		}
+		if c != 0 {
+			p.Elems = append(p.Elems, pack(t, c))
+		}
+	}
+	sort.Sort(uint64s(p.Elems))
+	return p
+}
+
+func checkPackedTopic(topic int) {
+	if topic < 0 || topic >= MaxPackedTopics {
+		panic(fmt.Sprintf("topic (%d) not in [0, %d)",
+			topic, MaxPackedTopics))
+	}
+}
+
+func pack(topic int32, count int64) uint64 {
+	return uint64(topic)<<packedCountBits | uint64(count)
+}
+
+func unpack(e uint64) (topic int32, count int64) {
+	return int32(e >> packedCountBits), int64(e & maxPackedCount)
+}
+
+// search returns the index of topic in p.Elems, or where to insert it.
+func (p *Packed) search(topic int32) int {
+	key := uint64(topic) << packedCountBits
+	lo, hi := 0, len(p.Elems)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if p.Elems[m] < key {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	return lo
+}
+
+func (p *Packed) find(topic int) (int, bool) {
+	i := p.search(int32(topic))
+	return i, i < len(p.Elems) && int(p.Elems[i]>>packedCountBits) == topic
+}
+
+func (p *Packed) Len() int {
+	return len(p.Elems)
+}
+
+func (p *Packed) At(topic int) int64 {
+	if i, ok := p.find(topic); ok {
+		_, c := unpack(p.Elems[i])
+		return int64(c)
+	}
+	return 0
+}
+
+func (p *Packed) Inc(topic, count int) {
+	checkPackedTopic(topic)
+	if count <= 0 {
+		panic(fmt.Sprintf("Inc(topic=%d, count=%d): count must > 0",
+			topic, count))
+	}
+	if int64(count) > maxPackedCount {
+		panic(fmt.Sprintf("count (%d) larger than %d",
+			count, int64(maxPackedCount)))
+	}
+	i, ok := p.find(topic)
+	if !ok {
+		p.Elems = append(p.Elems, 0)
+		copy(p.Elems[i+1:], p.Elems[i:])
+		p.Elems[i] = pack(int32(topic), int64(count))
+		return
+	}
+	_, c := unpack(p.Elems[i])
+	if c > maxPackedCount-int64(count) {
+		panic(fmt.Sprintf("p[%d] = %d overflow", topic, c))
+	}
+	p.Elems[i] += uint64(count)
+}
+
+func (p *Packed) Dec(topic, count int) {
+	if count <= 0 {
+		panic(fmt.Sprintf("Dec(topic=%d, count=%d): count must > 0",
+			topic, count))
+	}
+	i, ok := p.find(topic)
+	if !ok {
+		panic(fmt.Sprintf("topic %d does not exist", topic))
+	}
+	_, c := unpack(p.Elems[i])
+	if c < int64(count) {
+		panic(fmt.Sprintf("existing count (%d) < delta count (%d)",
+			c, count))
+	}
+	if c == int64(count) {
+		p.Elems = p.Elems[:i+copy(p.Elems[i:], p.Elems[i+1:])]
+		return
+	}
+	p.Elems[i] -= uint64(count)
+}
+
+// Packed.ForEach goes over elements in ascending order of topics.
+func (p *Packed) ForEach(f func(topic int, count int64) error) error {
+	for _, x := range p.Elems {
+		t, c := unpack(x)
+		if e := f(int(t), c); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (p *Packed) AppendNonZeros(topics []int32, counts []int64) (
+	[]int32, []int64) {
+	for _, x := range p.Elems {
+		t, c := unpack(x)
+		topics = append(topics, t)
+		counts = append(counts, c)
+	}
+	return topics, counts
+}
+
+func (p *Packed) Clone() Hist {
+	n := NewPacked()
+	if p.Elems != nil {
+		n.Elems = make([]uint64, len(p.Elems))
+		copy(n.Elems, p.Elems)
+	}
+	return n
+}
+
+// String prints a Packed variable the same format as OrderedSparse.
+func (p Packed) String() string {
+	out := "[ "
+	for _, x := range p.Elems {
+		t, c := unpack(x)
+		out += fmt.Sprintf("%d:%d ", t, c)
+	}
+	out += "]"
+	return out
+}
+
+type uint64s []uint64
+
+func (u uint64s) Len() int           { return len(u) }
+func (u uint64s) Less(i, j int) bool { return u[i] < u[j] }
+func (u uint64s) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
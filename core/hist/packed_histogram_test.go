@@ -0,0 +1,131 @@
+package hist
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPackedAssignSparse(t *testing.T) {
+	p := NewPacked().AssignSparse(Sparse{3: 10, 0: 7, 2: 1, 1: 2})
+	str := "[ 0:7 1:2 2:1 3:10 ]"
+	if fmt.Sprint(p) != str {
+		t.Errorf("Expected %s, got %v", str, p)
+	}
+	if p.At(3) != 10 || p.At(4) != 0 {
+		t.Errorf("Expecting p.At(3) = 10 and p.At(4) = 0, got %d and %d",
+			p.At(3), p.At(4))
+	}
+}
+
+func TestPackedIncDec(t *testing.T) {
+	p := NewPacked()
+	s := NewSparse()
+	rng := rand.New(rand.NewSource(-1))
+	for i := 0; i < 10000; i++ {
+		topic := rng.Intn(100)
+		if s[int32(topic)] > 0 && rng.Intn(2) == 0 {
+			c := rng.Intn(int(s[int32(topic)])) + 1
+			p.Dec(topic, c)
+			s.Dec(topic, c)
+		} else {
+			c := rng.Intn(5) + 1
+			p.Inc(topic, c)
+			s.Inc(topic, c)
+		}
+	}
+	if p.Len() != s.Len() {
+		t.Errorf("Expecting p.Len() = %d, got %d", s.Len(), p.Len())
+	}
+	if q := NewPacked().AssignSparse(s); !reflect.DeepEqual(p, q) {
+		t.Errorf("Expecting %v, got %v", q, p)
+	}
+}
+
+func TestPackedDecNonExisting(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expecting panic")
+		}
+	}()
+	NewPacked().AssignSparse(Sparse{1: 2}).Dec(0, 1)
+}
+
+func TestPackedIncOverflow(t *testing.T) {
+	p := NewPacked()
+	p.Inc(5, math.MaxInt32)
+	p.Inc(5, math.MaxInt32)
+	p.Inc(MaxPackedTopics-1, 1)
+	if p.At(5) != 2*math.MaxInt32 || p.At(MaxPackedTopics-1) != 1 {
+		t.Errorf("Expecting %d and 1, got %v", int64(2*math.MaxInt32), p)
+	}
+	q := NewPacked().AssignSparse(Sparse{5: 2 * math.MaxInt32,
+		MaxPackedTopics - 1: 1})
+	if !reflect.DeepEqual(p, q) {
+		t.Errorf("Expecting %v, got %v", p, q)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expecting panic on overflow")
+		}
+	}()
+	p.Inc(5, maxPackedCount-2*math.MaxInt32+1)
+}
+
+func TestPackedTopicOutOfRange(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expecting panic")
+		}
+	}()
+	NewPacked().Inc(MaxPackedTopics, 1)
+}
+
+func TestPackedCloneAndGob(t *testing.T) {
+	var p Hist = NewPacked().AssignSparse(Sparse{1: 2, 3: 4})
+	c := p.Clone()
+	if !reflect.DeepEqual(c, p) {
+		t.Errorf("Expected %v, got %v", p, c)
+	}
+
+	var buf bytes.Buffer
+	if e := gob.NewEncoder(&buf).Encode(&p); e != nil {
+		t.Fatalf("Encode: %v", e)
+	}
+	var q Hist
+	if e := gob.NewDecoder(&buf).Decode(&q); e != nil {
+		t.Fatalf("Decode: %v", e)
+	}
+	if !reflect.DeepEqual(q, p) {
+		t.Errorf("Expected %v, got %v", p, q)
+	}
+}
+
+func benchmarkHistIncDec(b *testing.B, h Hist) {
+	rng := rand.New(rand.NewSource(-1))
+	topics := make([]int, 1024)
+	for i := range topics {
+		topics[i] = rng.Intn(1000)
+		h.Inc(topics[i], 1)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t := topics[i%len(topics)]
+		h.Dec(t, 1)
+		h.Inc(t, 1)
+	}
+}
+
+func BenchmarkSparseIncDec(b *testing.B) {
+	benchmarkHistIncDec(b, NewSparse())
+}
+
+func BenchmarkPackedIncDec(b *testing.B) {
+	benchmarkHistIncDec(b, NewPacked())
+}
@@ -7,8 +7,10 @@ import (
 )
 
 // Sparse represents histogram using Go map.  Sparse represents word
-// topic-histograms in Phoenix model.
-type Sparse map[int32]int32
+// topic-histograms in Phoenix model.  Counts are 64-bit, so frequent
+// words in billion-token corpora do not overflow.  Models saved when
+// counts were 32-bit decode into Sparse as gob converts integers.
+type Sparse map[int32]int64
 
 func init() {
 	gob.Register(Sparse{})
@@ -63,14 +65,11 @@ func (s Sparse) Inc(topic, count int) {
 		panic(fmt.Sprintf("Inc(topic=%d, count=%d): count must > 0",
 			topic, count))
 	}
-	if count > int(math.MaxInt32) {
-		panic(fmt.Sprintf("count (%d) larger than MaxInt32", count))
-	}
 	t := int32(topic)
-	if s[t] >= math.MaxInt32-int32(count) {
+	if s[t] > math.MaxInt64-int64(count) {
 		panic(fmt.Sprintf("d[%d] = %d overflow", topic, s[t]))
 	}
-	s[t] += int32(count)
+	s[t] += int64(count)
 }
 
 func (s Sparse) Dec(topic, count int) {
@@ -79,7 +78,7 @@ func (s Sparse) Dec(topic, count int) {
 			topic, count))
 	}
 	t := int32(topic)
-	s[t] -= int32(count)
+	s[t] -= int64(count)
 	if s[t] == 0 {
 		delete(s, t)
 	}
@@ -87,13 +86,24 @@ func (s Sparse) Dec(topic, count int) {
 
 func (s Sparse) ForEach(p func(topic int, count int64) error) error {
 	for i, v := range s {
-		if e := p(int(i), int64(v)); e != nil {
+		if e := p(int(i), v); e != nil {
 			return e
 		}
 	}
 	return nil
 }
 
+func (s Sparse) AppendNonZeros(topics []int32, counts []int64) (
+	[]int32, []int64) {
+	for t, c := range s {
+		if c != 0 {
+			topics = append(topics, t)
+			counts = append(counts, c)
+		}
+	}
+	return topics, counts
+}
+
 func (s Sparse) Clone() Hist {
 	n := NewSparse()
 	for k, v := range s {
@@ -0,0 +1,141 @@
+package synth
+
+import (
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"math"
+)
+
+// Recovery scores how well model m, trained on a corpus generated
+// from g with vocabulary v, recovers the word distributions of g.  It
+// matches topics of m to those of g one to one, minimizing the total
+// Hellinger distance, using the Hungarian algorithm.  The score is the
+// mean of 1 - Hellinger distance over topics of g, where unmatched
+// topics score 0, so it is in [0, 1] and 1 means a perfect recovery.
+// matching[k] is the topic of m matched to topic k of g, or -1.
+func Recovery(g *GroundTruth, m *gibbs.Model, v *gibbs.Vocabulary) (
+	score float64, matching []int, e error) {
+	if m.VocabSize() != v.Len() {
+		return 0, nil, fmt.Errorf("Model has %d tokens, but vocabulary has %d",
+			m.VocabSize(), v.Len())
+	}
+	ids := make([]int32, len(g.Tokens))
+	for i, t := range g.Tokens {
+		if ids[i] = v.Id(t); ids[i] < 0 {
+			return 0, nil, fmt.Errorf("Token %s is not in vocabulary", t)
+		}
+	}
+
+	// Word distributions of m, in the order of g.Tokens.
+	a := gibbs.NewModelAccessor(m, 0)
+	phi := make([][]float64, m.NumTopics())
+	for t := range phi {
+		phi[t] = make([]float64, len(ids))
+		sum := 0.0
+		for i, id := range ids {
+			phi[t][i] = a.WordTopicProb(id, t)
+			sum += phi[t][i]
+		}
+		for i := range phi[t] {
+			phi[t][i] /= sum
+		}
+	}
+
+	// The cost matrix is padded to be square with distance 1.
+	n := g.NumTopics()
+	if len(phi) > n {
+		n = len(phi)
+	}
+	cost := make([][]float64, n)
+	for k := range cost {
+		cost[k] = make([]float64, n)
+		for t := range cost[k] {
+			if k < g.NumTopics() && t < len(phi) {
+				cost[k][t] = Hellinger(g.Phi[k], phi[t])
+			} else {
+				cost[k][t] = 1
+			}
+		}
+	}
+
+	assignment := hungarian(cost)
+	matching = make([]int, g.NumTopics())
+	for k := range matching {
+		matching[k] = -1
+		if t := assignment[k]; t < len(phi) {
+			matching[k] = t
+			score += 1 - cost[k][t]
+		}
+	}
+	return score / float64(g.NumTopics()), matching, nil
+}
+
+// Hellinger returns the Hellinger distance between distributions p
+// and q, which is in [0, 1].
+func Hellinger(p, q []float64) float64 {
+	s := 0.0
+	for i := range p {
+		d := math.Sqrt(p[i]) - math.Sqrt(q[i])
+		s += d * d
+	}
+	return math.Min(1, math.Sqrt(s/2))
+}
+
+// hungarian solves the assignment problem of an n x n cost matrix in
+// O(n^3), and returns the column assigned to each row.
+func hungarian(cost [][]float64) []int {
+	n := len(cost)
+	// Potentials u of rows and v of columns, and the row matched to
+	// each column, are 1-based, with 0 as a dummy.
+	u := make([]float64, n+1)
+	v := make([]float64, n+1)
+	p := make([]int, n+1)
+	way := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, n+1)
+		used := make([]bool, n+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], math.Inf(1), 0
+			for j := 1; j <= n; j++ {
+				if !used[j] {
+					cur := cost[i0-1][j-1] - u[i0] - v[j]
+					if cur < minv[j] {
+						minv[j], way[j] = cur, j0
+					}
+					if minv[j] < delta {
+						delta, j1 = minv[j], j
+					}
+				}
+			}
+			for j := 0; j <= n; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	assignment := make([]int, n)
+	for j := 1; j <= n; j++ {
+		assignment[p[j]-1] = j - 1
+	}
+	return assignment
+}
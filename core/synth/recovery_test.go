@@ -0,0 +1,78 @@
+package synth
+
+import (
+	"context"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/train"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHungarian(t *testing.T) {
+	cost := [][]float64{
+		{4, 1, 3},
+		{2, 0, 5},
+		{3, 2, 2}}
+	if a := hungarian(cost); !reflect.DeepEqual(a, []int{1, 0, 2}) {
+		t.Errorf("Expecting [1 0 2], got %v", a)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	g := NewGroundTruth(4, 40, 0.1, 0.05, rng)
+	v := gibbs.NewVocabulary()
+	if e := v.Load(strings.NewReader(strings.Join(g.Tokens, "\n"))); e != nil {
+		t.Fatal(e)
+	}
+
+	corpus := make([]*gibbs.Document, 0)
+	for _, words := range g.Corpus(400, PoissonLen(30), rng) {
+		corpus = append(corpus,
+			gibbs.InitializeDocument(words, v, g.NumTopics(), rng))
+	}
+	m := gibbs.NewModel(g.NumTopics(), v.Len(), 0.1, 0.05)
+	for _, d := range corpus {
+		d.ApplyToModel(m)
+	}
+
+	before, _, e := Recovery(g, m, v)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	opts := train.DefaultOptions()
+	opts.Iterations = 100
+	opts.EvalLag = 0
+	tr, e := train.New(m, corpus, opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := tr.Run(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+
+	after, matching, e := Recovery(g, m, v)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if after < 0.8 || after <= before {
+		t.Errorf("Expecting recovery > 0.8 and > %f before training, got %f",
+			before, after)
+	}
+	seen := make(map[int]bool)
+	for _, k := range matching {
+		if k < 0 || seen[k] {
+			t.Errorf("Expecting one-to-one matching, got %v", matching)
+		}
+		seen[k] = true
+	}
+
+	// Fewer topics in the model leave topics of g unmatched.
+	m2 := gibbs.NewModel(2, v.Len(), 0.1, 0.05)
+	if _, matching, _ := Recovery(g, m2, v); len(matching) != 4 {
+		t.Errorf("Expecting 4 matches, got %v", matching)
+	}
+}
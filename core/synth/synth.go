@@ -0,0 +1,193 @@
+// Package synth generates synthetic corpora from known LDA
+// parameters, and scores how well a trained model recovers the
+// parameters.  It makes benchmarks and regression tests of sampling
+// quality possible without private data.
+package synth
+
+import (
+	"encoding/gob"
+	"fmt"
+	cmprs "github.com/wangkuiyi/compress_io"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+)
+
+// GroundTruth contains parameters of the LDA generative process.
+type GroundTruth struct {
+	Tokens []string    // the vocabulary, indexed by word
+	Alpha  []float64   // topic priors
+	Phi    [][]float64 // word distributions of topics, in the order of Tokens
+}
+
+// NewGroundTruth creates a vocabulary of vocabSize tokens, and draws
+// topics word distributions from a symmetric Dirichlet prior beta.
+func NewGroundTruth(topics, vocabSize int, alpha, beta float64,
+	rng *rand.Rand) *GroundTruth {
+	g := &GroundTruth{
+		Tokens: make([]string, vocabSize),
+		Alpha:  make([]float64, topics),
+		Phi:    make([][]float64, topics),
+	}
+	for i := range g.Tokens {
+		g.Tokens[i] = fmt.Sprintf("w%d", i)
+	}
+	prior := make([]float64, vocabSize)
+	for i := range prior {
+		prior[i] = beta
+	}
+	for k := range g.Phi {
+		g.Alpha[k] = alpha
+		g.Phi[k] = Dirichlet(prior, rng)
+	}
+	return g
+}
+
+func (g *GroundTruth) NumTopics() int {
+	return len(g.Phi)
+}
+
+// Document draws a document of length words.  It returns the tokens
+// and their topics.
+func (g *GroundTruth) Document(length int, rng *rand.Rand) (
+	[]string, []int) {
+	theta := Dirichlet(g.Alpha, rng)
+	words := make([]string, length)
+	topics := make([]int, length)
+	for i := range words {
+		topics[i] = Discrete(theta, rng)
+		words[i] = g.Tokens[Discrete(g.Phi[topics[i]], rng)]
+	}
+	return words, topics
+}
+
+// DocLen draws the length of a document.
+type DocLen func(rng *rand.Rand) int
+
+// FixedLen returns a DocLen that always returns n.
+func FixedLen(n int) DocLen {
+	return func(*rand.Rand) int { return n }
+}
+
+// PoissonLen returns a DocLen that draws from a Poisson distribution
+// with mean, truncated to be at least 1.
+func PoissonLen(mean float64) DocLen {
+	return func(rng *rand.Rand) int {
+		n := 0
+		if mean > 30 {
+			// The normal approximation, as exp(-mean) underflows for
+			// large mean.
+			n = int(math.Floor(mean + math.Sqrt(mean)*rng.NormFloat64() + 0.5))
+		} else {
+			l, p := math.Exp(-mean), rng.Float64()
+			for p > l {
+				n++
+				p *= rng.Float64()
+			}
+		}
+		if n < 1 {
+			n = 1
+		}
+		return n
+	}
+}
+
+// Corpus draws numDocs documents, whose lengths are drawn from docLen.
+func (g *GroundTruth) Corpus(numDocs int, docLen DocLen,
+	rng *rand.Rand) [][]string {
+	corpus := make([][]string, numDocs)
+	for i := range corpus {
+		corpus[i], _ = g.Document(docLen(rng), rng)
+	}
+	return corpus
+}
+
+// Save saves g into filename in gob format, which is compressed if
+// filename ends with .gz.
+func (g *GroundTruth) Save(filename string) error {
+	f, e := os.Create(filename)
+	w := cmprs.NewWriter(f, e, path.Ext(filename))
+	if w == nil {
+		return fmt.Errorf("Cannot create file %s: %v", filename, e)
+	}
+	if e := gob.NewEncoder(w).Encode(g); e != nil {
+		w.Close()
+		return fmt.Errorf("Failed encoding ground truth: %v", e)
+	}
+	return w.Close()
+}
+
+func LoadGroundTruth(filename string) (*GroundTruth, error) {
+	f, e := os.Open(filename)
+	r := cmprs.NewReader(f, e, path.Ext(filename))
+	if r == nil {
+		return nil, fmt.Errorf("Cannot open %s: %v", filename, e)
+	}
+	defer r.Close()
+	g := new(GroundTruth)
+	if e := gob.NewDecoder(r).Decode(g); e != nil {
+		return nil, fmt.Errorf("Cannot decode %s: %v", filename, e)
+	}
+	return g, nil
+}
+
+// Dirichlet draws a distribution from a Dirichlet distribution with
+// parameters alpha.
+func Dirichlet(alpha []float64, rng *rand.Rand) []float64 {
+	dist := make([]float64, len(alpha))
+	sum := 0.0
+	for i, a := range alpha {
+		dist[i] = Gamma(a, rng)
+		sum += dist[i]
+	}
+	if sum <= 0 {
+		// All draws underflow for tiny alpha, pick one at random.
+		dist[rng.Intn(len(dist))] = 1
+		return dist
+	}
+	for i := range dist {
+		dist[i] /= sum
+	}
+	return dist
+}
+
+// Gamma draws from a Gamma distribution with shape a and scale 1,
+// using the method of Marsaglia and Tsang, *A Simple Method for
+// Generating Gamma Variables*, 2000.
+func Gamma(a float64, rng *rand.Rand) float64 {
+	if a < 1 {
+		// Gamma(a) = Gamma(a+1) * U^(1/a)
+		return Gamma(a+1, rng) * math.Pow(rng.Float64(), 1/a)
+	}
+	d := a - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// Discrete draws an index from an unnormalized distribution.
+func Discrete(dist []float64, rng *rand.Rand) int {
+	sum := 0.0
+	for _, p := range dist {
+		sum += p
+	}
+	u := rng.Float64() * sum
+	for i, p := range dist {
+		if u < p {
+			return i
+		}
+		u -= p
+	}
+	return len(dist) - 1
+}
@@ -0,0 +1,84 @@
+package synth
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestDirichlet(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, a := range []float64{0.01, 0.5, 2} {
+		d := Dirichlet([]float64{a, a, a}, rng)
+		sum := 0.0
+		for _, p := range d {
+			sum += p
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Expecting sum 1, got %f", sum)
+		}
+	}
+}
+
+func TestGammaMean(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, a := range []float64{0.3, 1, 5} {
+		sum := 0.0
+		n := 20000
+		for i := 0; i < n; i++ {
+			sum += Gamma(a, rng)
+		}
+		if mean := sum / float64(n); math.Abs(mean-a)/a > 0.05 {
+			t.Errorf("Expecting mean of Gamma(%f) %f, got %f", a, a, mean)
+		}
+	}
+}
+
+func TestPoissonLen(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, mean := range []float64{10, 100} {
+		l := PoissonLen(mean)
+		sum := 0
+		n := 10000
+		for i := 0; i < n; i++ {
+			sum += l(rng)
+		}
+		if m := float64(sum) / float64(n); math.Abs(m-mean)/mean > 0.05 {
+			t.Errorf("Expecting mean length %f, got %f", mean, m)
+		}
+	}
+	if FixedLen(7)(rng) != 7 {
+		t.Errorf("Expecting fixed length 7")
+	}
+}
+
+func TestCorpusAndSave(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	if e != nil {
+		t.Fatalf("Cannot create temp dir: %v", e)
+	}
+	defer os.RemoveAll(dir)
+
+	rng := rand.New(rand.NewSource(1))
+	g := NewGroundTruth(3, 20, 0.1, 0.1, rng)
+	c := g.Corpus(10, FixedLen(5), rng)
+	if len(c) != 10 || len(c[9]) != 5 {
+		t.Errorf("Expecting 10 documents of 5 words, got %v", c)
+	}
+
+	f := path.Join(dir, "truth.gz")
+	if e := g.Save(f); e != nil {
+		t.Fatal(e)
+	}
+	g1, e := LoadGroundTruth(f)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(g, g1) {
+		t.Errorf("Loaded ground truth differs")
+	}
+}
@@ -0,0 +1,297 @@
+package train
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/wangkuiyi/parallel"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// Trace records scalars of a chain at evaluated iterations.  Both
+// scalars are invariant to permutations of topics, so they are
+// comparable across chains.
+type Trace struct {
+	Iterations    []int
+	LogLikelihood []float64 // per token, i.e., -log(perplexity)
+	Entropy       []float64 // see TopicEntropy
+}
+
+func (t *Trace) Add(iter int, perplexity float64, m *gibbs.Model) {
+	t.Iterations = append(t.Iterations, iter)
+	t.LogLikelihood = append(t.LogLikelihood, -math.Log(perplexity))
+	t.Entropy = append(t.Entropy, TopicEntropy(m))
+}
+
+// Write writes the trace in lines of iteration, log-likelihood and
+// entropy, separated by tabs.
+func (t *Trace) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	for i, iter := range t.Iterations {
+		fmt.Fprintf(b, "%d\t%g\t%g\n", iter, t.LogLikelihood[i], t.Entropy[i])
+	}
+	return b.Flush()
+}
+
+// Save writes the trace into filename.
+func (t *Trace) Save(filename string) error {
+	f, e := os.Create(filename)
+	if e != nil {
+		return fmt.Errorf("Cannot create file %s: %v", filename, e)
+	}
+	defer f.Close()
+	return t.Write(f)
+}
+
+// LoadTrace reads a trace saved by Trace.Save.
+func LoadTrace(filename string) (*Trace, error) {
+	f, e := os.Open(filename)
+	if e != nil {
+		return nil, fmt.Errorf("Cannot open trace %s: %v", filename, e)
+	}
+	defer f.Close()
+	t, e := ReadTrace(f)
+	if e != nil {
+		return nil, fmt.Errorf("Cannot read trace %s: %v", filename, e)
+	}
+	return t, nil
+}
+
+// ReadTrace reads a trace written by Trace.Write.
+func ReadTrace(r io.Reader) (*Trace, error) {
+	t := new(Trace)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		var iter int
+		var ll, en float64
+		if _, e := fmt.Sscanf(s.Text(), "%d\t%g\t%g", &iter, &ll, &en); e != nil {
+			return nil, fmt.Errorf("Cannot parse trace line %q: %v", s.Text(), e)
+		}
+		t.Iterations = append(t.Iterations, iter)
+		t.LogLikelihood = append(t.LogLikelihood, ll)
+		t.Entropy = append(t.Entropy, en)
+	}
+	return t, s.Err()
+}
+
+// TopicEntropy returns the entropy of the distribution of tokens over
+// topics, which measures how evenly topics are used.
+func TopicEntropy(m *gibbs.Model) float64 {
+	total := 0.0
+	for t := 0; t < m.NumTopics(); t++ {
+		total += float64(m.GlobalTopicHist.At(t))
+	}
+	h := 0.0
+	for t := 0; t < m.NumTopics(); t++ {
+		if c := float64(m.GlobalTopicHist.At(t)); c > 0 {
+			h -= c / total * math.Log(c/total)
+		}
+	}
+	return h
+}
+
+// RHat returns the potential scale reduction factor of Gelman and
+// Rubin, given traces of the same length of multiple chains.  Values
+// close to 1 indicate that chains mix well.  It returns NaN if there
+// are less than 2 chains or 2 samples per chain.
+func RHat(chains [][]float64) float64 {
+	m := len(chains)
+	if m < 2 || len(chains[0]) < 2 {
+		return math.NaN()
+	}
+	n := len(chains[0])
+
+	means := make([]float64, m)
+	mean := 0.0
+	W := 0.0
+	for j, c := range chains {
+		for _, x := range c {
+			means[j] += x
+		}
+		means[j] /= float64(n)
+		mean += means[j] / float64(m)
+		s := 0.0
+		for _, x := range c {
+			s += (x - means[j]) * (x - means[j])
+		}
+		W += s / float64(n-1) / float64(m)
+	}
+	B := 0.0
+	for _, mj := range means {
+		B += (mj - mean) * (mj - mean)
+	}
+	B *= float64(n) / float64(m-1)
+
+	if W <= 0 {
+		if B <= 0 {
+			return 1
+		}
+		return math.Inf(1)
+	}
+	v := float64(n-1)/float64(n)*W + B/float64(n)
+	return math.Sqrt(v / W)
+}
+
+// Diagnostics contains R-hat of traces of chains at an iteration,
+// computed from the second half of samples up to the iteration, as
+// the first half is considered burn-in.
+type Diagnostics struct {
+	Iteration     int
+	Samples       int // per chain
+	LogLikelihood float64
+	Entropy       float64
+}
+
+// Agree returns true if R-hat of all traces are below threshold, e.g.,
+// 1.1.  NaN is considered agreed, as there are too few samples.
+func (d *Diagnostics) Agree(threshold float64) bool {
+	return !(d.LogLikelihood > threshold) && !(d.Entropy > threshold)
+}
+
+// Diagnose computes diagnostics of traces at iteration iter, which
+// all traces must have reached.  It returns an error if traces are not
+// evaluated at the same iterations up to iter, as RHat requires
+// samples of equal-length chains.
+func Diagnose(traces []*Trace, iter int) (*Diagnostics, error) {
+	ll := make([][]float64, len(traces))
+	en := make([][]float64, len(traces))
+	iters := traces[0].upTo(iter)
+	for i, t := range traces {
+		if !equalInts(iters, t.upTo(iter)) {
+			return nil, fmt.Errorf(
+				"Traces 0 and %d are evaluated at different iterations", i)
+		}
+		end := len(iters)
+		begin := end / 2
+		ll[i] = t.LogLikelihood[begin:end]
+		en[i] = t.Entropy[begin:end]
+	}
+	return &Diagnostics{
+		Iteration:     iter,
+		Samples:       len(ll[0]),
+		LogLikelihood: RHat(ll),
+		Entropy:       RHat(en),
+	}, nil
+}
+
+// upTo returns the evaluated iterations of t up to iter.
+func (t *Trace) upTo(iter int) []int {
+	end := 0
+	for end < len(t.Iterations) && t.Iterations[end] <= iter {
+		end++
+	}
+	return t.Iterations[:end]
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Chains runs independent chains in parallel, each by a Trainer, and
+// compares their traces.
+type Chains struct {
+	Trainers []*Trainer
+	Traces   []*Trace
+
+	mutex    sync.Mutex
+	reported map[int]int // iteration -> number of chains reported
+	onDiag   func(d *Diagnostics)
+}
+
+// NewChains creates a chain for each model and corpus, which must be
+// initialized independently.  Chain i uses opts with Seed opts.Seed+i.
+// Chains evaluate perplexity every opts.EvalLag iterations, and
+// onDiag, if not nil, is called with diagnostics of every evaluated
+// iteration once all chains have finished it.  opts.OnIteration is
+// called by all chains concurrently.  opts.Convergence is ignored, so
+// that all chains run the same iterations.
+func NewChains(models []*gibbs.Model, corpora [][]*gibbs.Document,
+	opts Options, onDiag func(d *Diagnostics)) (*Chains, error) {
+	if len(models) != len(corpora) {
+		return nil, fmt.Errorf("%d models, but %d corpora",
+			len(models), len(corpora))
+	}
+	if opts.EvalLag <= 0 {
+		return nil, fmt.Errorf("Chains requires evaluation, but EvalLag is %d",
+			opts.EvalLag)
+	}
+
+	c := &Chains{
+		Trainers: make([]*Trainer, len(models)),
+		Traces:   make([]*Trace, len(models)),
+		reported: make(map[int]int),
+		onDiag:   onDiag,
+	}
+	for i := range models {
+		o := opts
+		o.Seed = opts.Seed + int64(i)
+		o.Convergence = nil
+		c.Traces[i] = new(Trace)
+		i := i
+		o.OnIteration = func(s *IterationStats) error {
+			if s.Evaluated {
+				if e := c.report(i, s); e != nil {
+					return e
+				}
+			}
+			if opts.OnIteration != nil {
+				return opts.OnIteration(s)
+			}
+			return nil
+		}
+		var e error
+		if c.Trainers[i], e = New(models[i], corpora[i], o); e != nil {
+			return nil, e
+		}
+	}
+	return c, nil
+}
+
+func (c *Chains) report(chain int, s *IterationStats) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Traces[chain].Add(s.Iteration, s.Perplexity, c.Trainers[chain].Model)
+	if c.reported[s.Iteration]++; c.reported[s.Iteration] == len(c.Traces) {
+		delete(c.reported, s.Iteration)
+		if c.onDiag != nil {
+			d, e := Diagnose(c.Traces, s.Iteration)
+			if e != nil {
+				return e
+			}
+			c.onDiag(d)
+		}
+	}
+	return nil
+}
+
+// Run runs all chains in parallel.  If a chain fails, Run cancels the
+// others and returns the error of the failed chain.
+func (c *Chains) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var first error
+	var once sync.Once
+	parallel.For(0, len(c.Trainers), 1, func(i int) error {
+		e := c.Trainers[i].Run(ctx)
+		if e != nil {
+			once.Do(func() {
+				first = e
+				cancel()
+			})
+		}
+		return e
+	})
+	return first
+}
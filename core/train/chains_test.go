@@ -0,0 +1,125 @@
+package train
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRHat(t *testing.T) {
+	// W = 1, B = 0, so R-hat = sqrt(2/3).
+	r := RHat([][]float64{{1, 2, 3}, {1, 2, 3}})
+	if truth := math.Sqrt(2.0 / 3); math.Abs(r-truth) > 1e-9 {
+		t.Errorf("Expecting %f, got %f", truth, r)
+	}
+	// W = 1, B = 150, so R-hat = sqrt(2/3 + 150/3).
+	r = RHat([][]float64{{1, 2, 3}, {11, 12, 13}})
+	if truth := math.Sqrt(2.0/3 + 50); math.Abs(r-truth) > 1e-9 {
+		t.Errorf("Expecting %f, got %f", truth, r)
+	}
+	if r := RHat([][]float64{{1, 2, 3}}); !math.IsNaN(r) {
+		t.Errorf("Expecting NaN for a single chain, got %f", r)
+	}
+	if r := RHat([][]float64{{1, 1}, {1, 1}}); r != 1 {
+		t.Errorf("Expecting 1 for constant chains, got %f", r)
+	}
+}
+
+func TestTraceWriteAndRead(t *testing.T) {
+	tr := &Trace{[]int{0, 5}, []float64{-1.5, -1.25}, []float64{0.5, 0.75}}
+	var buf bytes.Buffer
+	if e := tr.Write(&buf); e != nil {
+		t.Fatal(e)
+	}
+	r, e := ReadTrace(&buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(tr, r) {
+		t.Errorf("Expecting %v, got %v", tr, r)
+	}
+}
+
+func TestChains(t *testing.T) {
+	models := make([]*gibbs.Model, 3)
+	corpora := make([][]*gibbs.Document, 3)
+	for i := range models {
+		corpora[i], models[i] = createTestingCorpus()
+	}
+	opts := testingOptions(Serial)
+	// Ignored, or chains would stop at different iterations.
+	opts.Convergence = []Rule{&RelativeChange{Window: 1, Tolerance: 1e9}}
+	diags := make([]*Diagnostics, 0)
+	c, e := NewChains(models, corpora, opts, func(d *Diagnostics) {
+		diags = append(diags, d)
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Run(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+
+	if len(diags) != opts.Iterations {
+		t.Fatalf("Expecting %d diagnostics, got %d", opts.Iterations, len(diags))
+	}
+	for i, d := range diags {
+		if d.Iteration != i {
+			t.Errorf("Expecting diagnostics in order, got %d at %d",
+				d.Iteration, i)
+		}
+	}
+	last := diags[len(diags)-1]
+	if last.Samples != 10 || math.IsNaN(last.LogLikelihood) ||
+		math.IsNaN(last.Entropy) {
+		t.Errorf("Expecting R-hat over 10 samples, got %+v", last)
+	}
+	if reflect.DeepEqual(c.Traces[0], c.Traces[1]) {
+		t.Errorf("Expecting chains with different seeds")
+	}
+}
+
+func TestChainsCancelOnError(t *testing.T) {
+	models := make([]*gibbs.Model, 3)
+	corpora := make([][]*gibbs.Document, 3)
+	for i := range models {
+		corpora[i], models[i] = createTestingCorpus()
+	}
+	opts := testingOptions(Serial)
+	opts.Iterations = 1000
+	var once sync.Once
+	opts.OnIteration = func(s *IterationStats) error {
+		var e error
+		once.Do(func() { e = errors.New("fail") })
+		return e
+	}
+	c, e := NewChains(models, corpora, opts, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Run(context.Background()); e == nil || e.Error() != "fail" {
+		t.Fatalf("Expecting error fail, got %v", e)
+	}
+	for i, tr := range c.Trainers {
+		if tr.Iteration() >= opts.Iterations {
+			t.Errorf("Expecting chain %d canceled, ran %d iterations",
+				i, tr.Iteration())
+		}
+	}
+}
+
+func TestDiagnoseMismatchedTraces(t *testing.T) {
+	a := &Trace{[]int{0, 1, 2}, []float64{1, 2, 3}, []float64{1, 2, 3}}
+	b := &Trace{[]int{0, 2}, []float64{1, 3}, []float64{1, 3}}
+	if _, e := Diagnose([]*Trace{a, b}, 2); e == nil {
+		t.Errorf("Expecting error for traces of different eval lags")
+	}
+	if d, e := Diagnose([]*Trace{a, a}, 2); e != nil || d.Samples != 2 {
+		t.Errorf("Expecting 2 samples, got %+v, %v", d, e)
+	}
+}
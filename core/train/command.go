@@ -0,0 +1,272 @@
+package train
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+)
+
+// Command defines the command line flags shared by cmd/singlethread
+// and cmd/multithread, and runs a Trainer configured by them.
+type Command struct {
+	addr                  *string
+	vocab, corpus         *string
+	minDocLen, maxDocLen  *int
+	topics                *int
+	gibbsIter             *int
+	alpha, beta           *float64
+	seed                  *int64
+	optimStart, optimIter *int
+	shape, scale          *float64
+	model                 *string
+	cache                 *int
+	evalLag               *int
+	kernel                *string
+	packed                *bool
+	averageBurnIn         *int
+	averageLag            *int
+	averageModel          *string
+	averageResolution     *float64
+	theta                 *string
+	thetaIters            *int
+	checkpoint            *string
+	checkpointLag         *int
+	resume                *string
+	convergeWindow        *int
+	convergeTol           *float64
+	coherence             *int
+	trace                 *string
+	testCorpus            *string
+	heldOutMethod         *string
+	heldOutPatience       *int
+}
+
+// NewCommand defines the flags of a Command in fs, usually
+// flag.CommandLine.
+func NewCommand(fs *flag.FlagSet) *Command {
+	c := &Command{}
+	c.addr = fs.String("addr", ":6060", "HTTP status page address")
+	c.vocab = fs.String("vocab", "./testdata/vocab", "Vocabulary file")
+	c.corpus = fs.String("corpus", "./testdata/corpus", "Corpus file")
+	c.minDocLen = fs.Int("minlen", 1, "minimum document length")
+	c.maxDocLen = fs.Int("maxlen", -1, "maximum document length")
+	c.topics = fs.Int("topics", 10, "Number of topics to be learned")
+	c.gibbsIter = fs.Int("gibbs_iter", 100, "Gibbs sampling iterations")
+	c.alpha = fs.Float64("alpha", 0.01, "Topic prior")
+	c.beta = fs.Float64("beta", 0.01, "Word prior")
+	c.seed = fs.Int64("seed", -1, "Seed of random number generators")
+	c.optimStart = fs.Int("optim_start", 10,
+		"The Gibbs sampling iteration since when it optimize hyperparams")
+	c.shape = fs.Float64("shape", 0.0, "Shape")
+	c.scale = fs.Float64("scale", 1e7, "Scale")
+	c.optimIter = fs.Int("optim_iter", 10, "Iterations of optimization")
+	c.model = fs.String("model", "", "The model output")
+	c.cache = fs.Int("cache", 0, "Smoothing model cache in MB")
+	c.evalLag = fs.Int("eval_lag", 1, "Evaluation lag")
+	c.kernel = fs.String("kernel", gibbs.SparseLDAKernel,
+		"Sampling kernel, sparselda or alias")
+	c.packed = fs.Bool("packed", false,
+		"Store word topic-histograms in packed arrays to save memory")
+	c.averageBurnIn = fs.Int("average_burnin", 50,
+		"The Gibbs sampling iteration since when it averages models")
+	c.averageLag = fs.Int("average_lag", 10,
+		"Average the model every average_lag iterations after burn-in")
+	c.averageModel = fs.String("average_model", "",
+		"The averaged model output, averaging is disabled if empty")
+	c.averageResolution = fs.Float64("average_resolution", 100,
+		"Resolution of fractional counts in the averaged model")
+	c.theta = fs.String("theta", "",
+		"Output topic distributions of documents, keyed by line number")
+	c.thetaIters = fs.Int("theta_iters", 1,
+		"Average topic distributions of documents over the last iterations")
+	c.checkpoint = fs.String("checkpoint", "",
+		"Checkpoint file written periodically and on SIGINT")
+	c.checkpointLag = fs.Int("checkpoint_lag", 10,
+		"Write checkpoint every checkpoint_lag iterations")
+	c.resume = fs.String("resume", "",
+		"Resume training from this checkpoint file")
+	c.convergeWindow = fs.Int("converge_window", 0,
+		"Stop if perplexity changes little over this many evaluations, "+
+			"disabled if 0")
+	c.convergeTol = fs.Float64("converge_tol", 1e-3,
+		"Relative change of perplexity considered converged")
+	c.coherence = fs.Int("coherence_len", 0,
+		"Log coherence of top words at evaluation iterations, disabled if 0")
+	c.trace = fs.String("trace", "",
+		"Output log-likelihood and topic entropy at evaluation iterations, "+
+			"to be compared with other chains by cmd/chains")
+	c.testCorpus = fs.String("test_corpus", "",
+		"Held-out corpus evaluated every eval_lag iterations")
+	c.heldOutMethod = fs.String("heldout_method", gibbs.DocumentCompletion,
+		"Held-out estimator, completion or left-to-right")
+	c.heldOutPatience = fs.Int("heldout_patience", 0,
+		"Stop if held-out perplexity rises in this many evaluations, "+
+			"disabled if 0")
+	return c
+}
+
+// Options returns Options configured by the flags.  Callers set
+// Strategy, Shards and Partitions before passing them to Run.
+func (c *Command) Options() Options {
+	opts := DefaultOptions()
+	opts.Kernel = *c.kernel
+	opts.Packed = *c.packed
+	opts.Iterations = *c.gibbsIter
+	opts.OptimStart = *c.optimStart
+	opts.OptimIter = *c.optimIter
+	opts.Shape = *c.shape
+	opts.Scale = *c.scale
+	opts.EvalLag = *c.evalLag
+	opts.CacheMB = *c.cache
+	opts.Seed = *c.seed
+	opts.AverageBurnIn = *c.averageBurnIn
+	if len(*c.averageModel) > 0 {
+		opts.AverageLag = *c.averageLag
+	}
+	if len(*c.theta) > 0 {
+		opts.ThetaIters = *c.thetaIters
+	}
+	if *c.convergeWindow > 0 {
+		opts.Convergence = append(opts.Convergence, &RelativeChange{
+			Window: *c.convergeWindow, Tolerance: *c.convergeTol})
+	}
+	return opts
+}
+
+// Run loads the corpus, trains a model with opts, or resumes from a
+// checkpoint, and writes outputs specified by the flags.  On SIGINT,
+// it checkpoints and writes outputs of the current model.
+func (c *Command) Run(opts Options) error {
+	if len(*c.checkpoint) > 0 && *c.checkpointLag <= 0 {
+		return fmt.Errorf("checkpoint_lag = %d, not positive",
+			*c.checkpointLag)
+	}
+
+	is := utils.EnableExpvar(*c.addr)
+	log.Printf("Initialization start at %s", is.Start().StartTime)
+
+	var trainer *Trainer
+	trace := new(Trace)
+	checkpoint := func() {
+		if e := utils.SaveCheckpoint(trainer.Checkpoint(),
+			*c.checkpoint); e != nil {
+			log.Printf("Failed checkpointing: %v", e)
+		}
+	}
+
+	opts.OnIteration = func(s *IterationStats) error {
+		if s.Evaluated {
+			log.Printf("Iteration %04d perplexity %f", s.Iteration, s.Perplexity)
+			trace.Add(s.Iteration, s.Perplexity, trainer.Model)
+		}
+		if s.Evaluated && *c.coherence > 0 {
+			umass, npmi := gibbs.MeanCoherence(gibbs.ComputeCoherence(
+				trainer.Model, trainer.Corpus, *c.coherence))
+			log.Printf("Iteration %04d coherence UMass %f NPMI %f",
+				s.Iteration, umass, npmi)
+		}
+		if s.HeldOutPerplexity > 0 {
+			log.Printf("Iteration %04d held-out perplexity %f",
+				s.Iteration, s.HeldOutPerplexity)
+		}
+		log.Printf("Iteration %04d done in %s", s.Iteration, s.Duration)
+		*is = append(*is, &utils.Iteration{
+			StartTime: s.StartTime, Duration: s.Duration,
+			Perplexity: s.Perplexity, StopReason: s.StopReason})
+		if len(s.StopReason) > 0 {
+			log.Printf("Iteration %04d converged: %s", s.Iteration, s.StopReason)
+		}
+		if len(*c.checkpoint) > 0 && (s.Iteration+1)%*c.checkpointLag == 0 {
+			checkpoint()
+		}
+		return nil
+	}
+
+	var ckpt *utils.Checkpoint
+	topics := *c.topics
+	if len(*c.resume) > 0 {
+		var e error
+		if ckpt, e = utils.LoadCheckpoint(*c.resume); e != nil {
+			return e
+		}
+		topics = ckpt.Model.NumTopics()
+	}
+
+	vocab := utils.LoadVocabOrDie(*c.vocab)
+	rng := rand.New(utils.NewSource(-1))
+	corpus, lines := utils.LoadIndexedCorpusOrDie(*c.corpus, vocab,
+		topics, *c.minDocLen, *c.maxDocLen, rng)
+
+	if len(*c.testCorpus) > 0 {
+		test := utils.LoadCorpusOrDie(*c.testCorpus, vocab, topics,
+			*c.minDocLen, *c.maxDocLen, rng)
+		heldOut, e := HeldOut(test, *c.heldOutMethod, *c.cache, opts.Seed)
+		if e != nil {
+			return e
+		}
+		opts.HeldOut = heldOut
+		if *c.heldOutPatience > 0 {
+			opts.Convergence = append(opts.Convergence,
+				&HeldOutRising{Patience: *c.heldOutPatience})
+		}
+	}
+
+	var e error
+	if ckpt != nil {
+		// Settings in the checkpoint override command line flags.
+		trainer, e = Resume(ckpt, corpus, opts)
+	} else {
+		model := utils.InitializeModel(corpus, vocab, topics,
+			*c.alpha, *c.beta)
+		trainer, e = New(model, corpus, opts)
+	}
+	if e != nil {
+		return fmt.Errorf("Cannot create trainer: %v", e)
+	}
+
+	log.Printf("Initialization done in %s", is.End(0.0).Duration)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		log.Printf("Caught signal, will checkpoint and exit ...")
+		cancel()
+	}()
+
+	if e := trainer.Run(ctx); e == context.Canceled {
+		log.Printf("Early terminated by signal.")
+		if len(*c.checkpoint) > 0 {
+			checkpoint()
+		}
+	} else if e != nil {
+		return e
+	}
+
+	model, thetas := trainer.Model, trainer.Thetas
+	if len(*c.theta) > 0 && thetas.Samples() <= 0 {
+		// Early terminated before the last iterations.
+		thetas.Add(corpus)
+	}
+
+	if len(*c.trace) > 0 {
+		if e := trace.Save(*c.trace); e != nil {
+			return e
+		}
+	}
+	if e := utils.SaveModel(model, *c.model); e != nil {
+		return e
+	}
+	if e := utils.SaveAveragedModel(trainer.Averager, *c.averageResolution,
+		*c.averageModel); e != nil {
+		return e
+	}
+	return utils.SaveTheta(thetas, model, lines, *c.theta)
+}
@@ -0,0 +1,32 @@
+package train
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestCommandOptions(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c := NewCommand(fs)
+	if e := fs.Parse([]string{"-gibbs_iter=7", "-kernel=alias", "-packed",
+		"-average_model=/tmp/a", "-average_lag=3", "-converge_window=2",
+		"-seed=5"}); e != nil {
+		t.Fatal(e)
+	}
+	opts := c.Options()
+	if opts.Iterations != 7 || opts.Kernel != "alias" || !opts.Packed ||
+		opts.Seed != 5 {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if opts.AverageLag != 3 {
+		t.Errorf("Expecting AverageLag 3, got %d", opts.AverageLag)
+	}
+	if opts.ThetaIters != 0 {
+		t.Errorf("Expecting ThetaIters 0 without -theta, got %d",
+			opts.ThetaIters)
+	}
+	if len(opts.Convergence) != 1 {
+		t.Errorf("Expecting 1 convergence rule, got %d",
+			len(opts.Convergence))
+	}
+}
@@ -0,0 +1,91 @@
+package train
+
+import (
+	"fmt"
+	"math"
+)
+
+// Rule decides whether training has converged given the history of
+// evaluated iterations, in the order of iterations.  It returns a
+// non-empty reason if it fires.
+type Rule interface {
+	Check(history []*IterationStats) string
+}
+
+// RelativeChange fires if the relative change of training perplexity
+// over the last Window evaluations is less than Tolerance.
+type RelativeChange struct {
+	Window    int
+	Tolerance float64
+}
+
+func (r *RelativeChange) Check(history []*IterationStats) string {
+	if r.Window <= 0 || len(history) <= r.Window {
+		return ""
+	}
+	old := history[len(history)-1-r.Window].Perplexity
+	cur := history[len(history)-1].Perplexity
+	if change := math.Abs(old-cur) / old; change < r.Tolerance {
+		return fmt.Sprintf("perplexity changed %g over %d evaluations, "+
+			"less than %g", change, r.Window, r.Tolerance)
+	}
+	return ""
+}
+
+// HeldOutRising fires if the held-out perplexity rose in each of the
+// last Patience evaluations, which indicates over-fitting.
+// Evaluations without held-out perplexity are ignored.
+type HeldOutRising struct {
+	Patience int
+}
+
+func (r *HeldOutRising) Check(history []*IterationStats) string {
+	if r.Patience <= 0 {
+		return ""
+	}
+	rises := 0
+	prev := 0.0
+	for i := len(history) - 1; i >= 0 && rises < r.Patience; i-- {
+		pp := history[i].HeldOutPerplexity
+		if pp <= 0 {
+			continue
+		}
+		if prev > 0 && prev <= pp {
+			break
+		}
+		if prev > 0 {
+			rises++
+		}
+		prev = pp
+	}
+	if rises >= r.Patience {
+		return fmt.Sprintf("held-out perplexity rose in %d evaluations",
+			rises)
+	}
+	return ""
+}
+
+// Monitor records evaluated iterations and checks rules.
+type Monitor struct {
+	Rules   []Rule
+	history []*IterationStats
+}
+
+func NewMonitor(rules ...Rule) *Monitor {
+	return &Monitor{Rules: rules}
+}
+
+// Observe records s if it is evaluated, and returns the reason of
+// the first rule that fires, or an empty string.
+func (m *Monitor) Observe(s *IterationStats) string {
+	if !s.Evaluated {
+		return ""
+	}
+	m.history = append(m.history, s)
+	for _, r := range m.Rules {
+		if reason := r.Check(m.history); len(reason) > 0 {
+			return reason
+		}
+	}
+	return ""
+}
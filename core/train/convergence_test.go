@@ -0,0 +1,71 @@
+package train
+
+import (
+	"context"
+	"testing"
+)
+
+func evaluated(pps ...float64) []*IterationStats {
+	h := make([]*IterationStats, len(pps))
+	for i, pp := range pps {
+		h[i] = &IterationStats{Iteration: i, Evaluated: true, Perplexity: pp,
+			HeldOutPerplexity: pp}
+	}
+	return h
+}
+
+func TestRelativeChange(t *testing.T) {
+	r := &RelativeChange{Window: 2, Tolerance: 0.01}
+	if s := r.Check(evaluated(100, 100)); len(s) > 0 {
+		t.Errorf("Expecting not fired with short history, got %s", s)
+	}
+	if s := r.Check(evaluated(100, 90, 80)); len(s) > 0 {
+		t.Errorf("Expecting not fired, got %s", s)
+	}
+	if s := r.Check(evaluated(100, 80, 79.9, 79.5)); len(s) == 0 {
+		t.Errorf("Expecting fired")
+	}
+}
+
+func TestHeldOutRising(t *testing.T) {
+	r := &HeldOutRising{Patience: 2}
+	if s := r.Check(evaluated(100, 90, 91)); len(s) > 0 {
+		t.Errorf("Expecting not fired, got %s", s)
+	}
+	if s := r.Check(evaluated(100, 90, 91, 91, 92)); len(s) > 0 {
+		t.Errorf("Expecting not fired, got %s", s)
+	}
+	if s := r.Check(evaluated(100, 90, 91, 92)); len(s) == 0 {
+		t.Errorf("Expecting fired")
+	}
+
+	// Evaluations without held-out perplexity are ignored.
+	h := evaluated(100, 90, 0, 91, 92)
+	if s := r.Check(h); len(s) == 0 {
+		t.Errorf("Expecting fired")
+	}
+}
+
+func TestTrainerConverge(t *testing.T) {
+	corpus, m := createTestingCorpus()
+	opts := testingOptions(Serial)
+	opts.Iterations = 1000
+	opts.Convergence = []Rule{&RelativeChange{Window: 1, Tolerance: 0.5}}
+	reason := ""
+	opts.OnIteration = func(s *IterationStats) error {
+		reason = s.StopReason
+		return nil
+	}
+	tr, e := New(m, corpus, opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := tr.Run(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+	if tr.Iteration() != 2 || len(tr.StopReason()) == 0 ||
+		reason != tr.StopReason() {
+		t.Errorf("Expecting converged after 2 iterations, got %d, %q",
+			tr.Iteration(), tr.StopReason())
+	}
+}
@@ -0,0 +1,44 @@
+package train
+
+import (
+	"fmt"
+	"github.com/wangkuiyi/parallel"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"math"
+	"math/rand"
+)
+
+// HeldOut returns a function for Options.HeldOut, which evaluates the
+// perplexity of docs unseen in training using method, as described in
+// gibbs.HeldOutEvaluator.  Documents are evaluated in parallel.  The
+// random number stream of each document is derived from seed and the
+// document index, so evaluations in different iterations are
+// comparable.
+func HeldOut(docs []*gibbs.Document, method string, cacheMB int,
+	seed int64) (func(m *gibbs.Model) float64, error) {
+	if method != gibbs.DocumentCompletion && method != gibbs.LeftToRight {
+		return nil, fmt.Errorf("Unknown held-out method %s", method)
+	}
+	if len(docs) <= 0 {
+		return nil, fmt.Errorf("Empty held-out corpus")
+	}
+
+	return func(m *gibbs.Model) float64 {
+		h, _ := gibbs.NewHeldOutEvaluator(m, method, cacheMB)
+		logLs := make([]float64, len(docs))
+		nWs := make([]int, len(docs))
+		parallel.For(0, len(docs), 1, func(d int) error {
+			rng := rand.New(utils.NewSource(utils.DocumentSeed(seed, 0, d)))
+			logLs[d], nWs[d] = h.Perplexity(docs[d], rng)
+			return nil
+		})
+		logL := 0.0
+		nW := 0
+		for d := range logLs {
+			logL += logLs[d]
+			nW += nWs[d]
+		}
+		return math.Exp(-logL / float64(nW))
+	}, nil
+}
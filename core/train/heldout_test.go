@@ -0,0 +1,32 @@
+package train
+
+import (
+	"context"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"testing"
+)
+
+func TestTrainerHeldOut(t *testing.T) {
+	corpus, m := createTestingCorpus()
+	test, _ := createTestingCorpus()
+	heldOut, e := HeldOut(test[:10], gibbs.LeftToRight, 0, 1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	opts := testingOptions(Parallel)
+	opts.HeldOut = heldOut
+	opts.OnIteration = func(s *IterationStats) error {
+		if s.HeldOutPerplexity <= 1 || s.HeldOutPerplexity > 4 {
+			t.Errorf("Expecting held-out perplexity in (1, 4], got %f",
+				s.HeldOutPerplexity)
+		}
+		return nil
+	}
+	tr, e := New(m, corpus, opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := tr.Run(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+}
@@ -0,0 +1,122 @@
+package train
+
+import (
+	"github.com/wangkuiyi/parallel"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"math/rand"
+)
+
+// strategy samples the corpus in an iteration.  Trainer optimizes
+// topic priors between sample and afterIteration.
+type strategy interface {
+	sample(iter int) error
+	afterIteration()
+	evaluate(eval *gibbs.Evaluator) (logL float64, nW int)
+}
+
+// serialStrategy samples documents one by one using the random number
+// stream of the trainer, which is saved in checkpoints.
+type serialStrategy struct {
+	t      *Trainer
+	kernel gibbs.Kernel
+	rng    *rand.Rand
+}
+
+func newSerial(t *Trainer) (*serialStrategy, error) {
+	k, e := gibbs.NewKernel(t.opts.Kernel, t.Model)
+	if e != nil {
+		return nil, e
+	}
+	return &serialStrategy{t: t, kernel: k, rng: t.newRand()}, nil
+}
+
+func (s *serialStrategy) sample(iter int) error {
+	// Rebuild caches in the kernel at the beginning of every
+	// iteration, so that a run resumed from a checkpoint with a new
+	// kernel continues bit-for-bit.
+	s.kernel.AfterOptimization()
+	for _, d := range s.t.Corpus {
+		s.kernel.Sample(d, s.rng)
+	}
+	return nil
+}
+
+func (s *serialStrategy) afterIteration() {}
+
+func (s *serialStrategy) evaluate(eval *gibbs.Evaluator) (float64, int) {
+	logL := 0.0
+	nW := 0
+	for _, d := range s.t.Corpus {
+		ll, nw := eval.Perplexity(d)
+		logL += ll
+		nW += nw
+	}
+	return logL, nW
+}
+
+// parallelStrategy divides the corpus into partitions, and samples
+// them with a gibbs.ParallelSampler, where shards share the model.
+// Each partition is sampled against the model as of the beginning of
+// an iteration plus updates of its own documents.  As the random
+// number stream of each document is derived from the seed, the
+// iteration and the document index, and updates of partitions are
+// merged in a fixed order, results depend on the number of partitions
+// but not on the number of shards or GOMAXPROCS.
+type parallelStrategy struct {
+	t          *Trainer
+	partitions int
+	sampler    *gibbs.ParallelSampler
+}
+
+func newParallel(t *Trainer) (*parallelStrategy, error) {
+	p := &parallelStrategy{t: t, partitions: t.opts.Partitions}
+	if p.partitions <= 0 || p.partitions > len(t.Corpus) {
+		p.partitions = len(t.Corpus)
+	}
+	shards := t.opts.Shards
+	if shards <= 0 || shards > p.partitions {
+		shards = p.partitions
+	}
+
+	var e error
+	if p.sampler, e = gibbs.NewParallelSampler(t.Model, t.opts.Kernel,
+		shards); e != nil {
+		return nil, e
+	}
+	p.sampler.NewSource = func() rand.Source { return utils.NewSource(0) }
+	return p, nil
+}
+
+func (p *parallelStrategy) sample(iter int) error {
+	p.sampler.Sample(p.t.Corpus, p.partitions, func(d int) int64 {
+		return utils.DocumentSeed(p.t.opts.Seed, iter, d)
+	})
+	return nil
+}
+
+// afterIteration does nothing, as the sampler rebuilds kernels from
+// the model before sampling each partition.
+func (p *parallelStrategy) afterIteration() {}
+
+func (p *parallelStrategy) evaluate(eval *gibbs.Evaluator) (float64, int) {
+	corpus := p.t.Corpus
+	// Sum up per-partition results in a fixed order.
+	logLs := make([]float64, p.partitions)
+	nWs := make([]int, p.partitions)
+	parallel.For(0, p.partitions, 1, func(i int) error {
+		for d := i; d < len(corpus); d += p.partitions {
+			ll, nw := eval.Perplexity(corpus[d])
+			logLs[i] += ll
+			nWs[i] += nw
+		}
+		return nil
+	})
+	logL := 0.0
+	nW := 0
+	for i := range logLs {
+		logL += logLs[i]
+		nW += nWs[i]
+	}
+	return logL, nW
+}
@@ -0,0 +1,323 @@
+// Package train implements the training loop of LDA models, so that
+// it can be embedded in other programs as well as command line
+// trainers cmd/singlethread and cmd/multithread.
+package train
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	// Serial samples documents one by one in a goroutine.
+	Serial = "serial"
+
+	// Parallel samples partitions of documents in parallel.  Results
+	// depend on Options.Partitions but not on Options.Shards.
+	Parallel = "parallel"
+)
+
+// Options configures a Trainer.  DefaultOptions returns the default
+// values used by command line trainers.
+type Options struct {
+	Strategy   string // Serial or Parallel
+	Kernel     string // passed to gibbs.NewKernel
+	Iterations int    // total number of Gibbs sampling iterations
+
+	// If Packed, the model stores word topic-histograms in
+	// hist.Packed to save memory.  See gibbs.Model.Pack.
+	Packed bool
+
+	// Topic priors are optimized after each iteration later than
+	// OptimStart.  See Optimizer.OptimizeTopicPriors for the others.
+	OptimStart int
+	OptimIter  int
+	Shape      float64
+	Scale      float64
+
+	// Perplexity is evaluated every EvalLag iterations, or never if
+	// EvalLag is not positive.  See NewEvaluator for CacheMB.
+	EvalLag int
+	CacheMB int
+
+	// Used by the Parallel strategy only.
+	Shards     int
+	Partitions int
+
+	// Seed of the random number generator.  The Serial strategy uses
+	// a stream seeded by Seed.  The Parallel strategy derives a
+	// stream for each document and iteration from Seed.
+	Seed int64
+
+	// The model is accumulated into Trainer.Averager every
+	// AverageLag iterations since iteration AverageBurnIn, or never if
+	// AverageLag is not positive.
+	AverageBurnIn int
+	AverageLag    int
+
+	// HeldOut, if not nil, evaluates held-out perplexity in
+	// iterations when training perplexity is evaluated.
+	HeldOut func(m *gibbs.Model) float64
+
+	// Training stops early if any of Convergence fires.  Rules see
+	// only iterations evaluated by this run, not those before a
+	// checkpoint.
+	Convergence []Rule
+
+	// Topic assignments of the last ThetaIters iterations are
+	// accumulated into Trainer.Thetas.
+	ThetaIters int
+
+	// OnIteration, if not nil, is called after each iteration.  If it
+	// returns an error, Run stops and returns the error.  A checkpoint
+	// created by OnIteration resumes from the next iteration.
+	OnIteration func(s *IterationStats) error
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Strategy:      Serial,
+		Kernel:        gibbs.SparseLDAKernel,
+		Iterations:    100,
+		OptimStart:    10,
+		OptimIter:     10,
+		Shape:         0.0,
+		Scale:         1e7,
+		EvalLag:       1,
+		CacheMB:       0,
+		Shards:        2,
+		Partitions:    16,
+		Seed:          -1,
+		AverageBurnIn: 50,
+		AverageLag:    0,
+		ThetaIters:    0,
+	}
+}
+
+// IterationStats is passed to Options.OnIteration.
+type IterationStats struct {
+	Iteration  int
+	StartTime  time.Time
+	Duration   time.Duration // excluding evaluation
+	Evaluated  bool          // false if perplexity is not evaluated
+	Perplexity float64
+
+	HeldOutPerplexity float64   // 0 if not evaluated
+	TopicPrior        []float64 // shared with the model, do not modify
+
+	// StopReason is non-empty if training converged and stops after
+	// this iteration.
+	StopReason string
+}
+
+// Trainer runs Gibbs sampling iterations on a corpus.  Model, Corpus,
+// Averager and Thetas are updated in place, and they are consistent
+// with each other after Run returns.
+type Trainer struct {
+	Model    *gibbs.Model
+	Corpus   []*gibbs.Document
+	Averager *gibbs.Averager
+	Thetas   *gibbs.ThetaAccumulator
+
+	opts       Options
+	iteration  int // the next iteration to run
+	src        *utils.Source
+	strategy   strategy
+	monitor    *Monitor
+	stopReason string
+}
+
+// New creates a Trainer that trains model, which must be initialized
+// with topic assignments in corpus, e.g., by utils.InitializeModel.
+func New(model *gibbs.Model, corpus []*gibbs.Document, opts Options) (
+	*Trainer, error) {
+	if len(corpus) <= 0 {
+		return nil, errors.New("Empty corpus")
+	}
+	if opts.Iterations < 0 {
+		return nil, fmt.Errorf("Negative iterations %d", opts.Iterations)
+	}
+	if opts.Packed {
+		if model.NumTopics() > hist.MaxPackedTopics {
+			return nil, fmt.Errorf("Cannot pack %d topics, more than %d",
+				model.NumTopics(), hist.MaxPackedTopics)
+		}
+		model.Pack()
+	}
+	t := &Trainer{
+		Model:    model,
+		Corpus:   corpus,
+		Averager: gibbs.NewAverager(model.NumTopics(), model.VocabSize()),
+		Thetas:   gibbs.NewThetaAccumulator(len(corpus)),
+		opts:     opts,
+		src:      utils.NewSource(opts.Seed),
+		monitor:  NewMonitor(opts.Convergence...),
+	}
+
+	var e error
+	switch opts.Strategy {
+	case Serial, "":
+		t.strategy, e = newSerial(t)
+	case Parallel:
+		t.strategy, e = newParallel(t)
+	default:
+		e = fmt.Errorf("Unknown strategy %s, expecting %s or %s",
+			opts.Strategy, Serial, Parallel)
+	}
+	if e != nil {
+		return nil, e
+	}
+	return t, nil
+}
+
+// Resume creates a Trainer that continues training bit-for-bit from
+// checkpoint c.  corpus must be loaded from the same corpus file with
+// the same options as when c was created.  Settings saved in c
+// override those in opts.
+func Resume(c *utils.Checkpoint, corpus []*gibbs.Document, opts Options) (
+	*Trainer, error) {
+	if e := c.Restore(corpus); e != nil {
+		return nil, e
+	}
+	opts.Kernel = c.Kernel
+	opts.Packed = c.Packed
+	opts.OptimStart = c.OptimStart
+	opts.OptimIter = c.OptimIter
+	opts.Shape = c.Shape
+	opts.Scale = c.Scale
+	opts.Partitions = c.Partitions
+	opts.Seed = c.Seed
+
+	t, e := New(c.Model, corpus, opts)
+	if e != nil {
+		return nil, e
+	}
+	t.iteration = c.Iteration
+	*t.src = c.RNG
+	if c.Averager != nil {
+		t.Averager = c.Averager
+	}
+	if c.Thetas != nil {
+		t.Thetas = c.Thetas
+	}
+	return t, nil
+}
+
+// Iteration returns the number of iterations that have been run.
+func (t *Trainer) Iteration() int {
+	return t.iteration
+}
+
+// Checkpoint returns a checkpoint of the current state, which shares
+// the model and accumulators with t.
+func (t *Trainer) Checkpoint() *utils.Checkpoint {
+	c := utils.NewCheckpoint(t.Model, t.Corpus, t.iteration, t.src)
+	c.Kernel = t.opts.Kernel
+	c.Packed = t.opts.Packed
+	c.OptimStart = t.opts.OptimStart
+	c.OptimIter = t.opts.OptimIter
+	c.Shape = t.opts.Shape
+	c.Scale = t.opts.Scale
+	c.Partitions = t.opts.Partitions
+	c.Seed = t.opts.Seed
+	c.Averager = t.Averager
+	c.Thetas = t.Thetas
+	return c
+}
+
+// Run runs iterations until Options.Iterations iterations have been
+// run, or a rule in Options.Convergence fires.  It checks ctx before
+// each iteration, and returns ctx.Err() if ctx is done.  In any case,
+// Run returns between iterations, so the trainer can be checkpointed
+// or run again.
+func (t *Trainer) Run(ctx context.Context) error {
+	t.stopReason = ""
+	for t.iteration < t.opts.Iterations {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		s := &IterationStats{Iteration: t.iteration, StartTime: time.Now()}
+		if e := t.runIteration(); e != nil {
+			return fmt.Errorf("Iteration %d: %v", t.iteration, e)
+		}
+		s.Duration = time.Since(s.StartTime)
+		s.TopicPrior = t.Model.TopicPrior
+		t.iteration++
+
+		if t.opts.EvalLag > 0 && s.Iteration%t.opts.EvalLag == 0 {
+			s.Evaluated = true
+			s.Perplexity = t.Perplexity()
+			if t.opts.HeldOut != nil {
+				s.HeldOutPerplexity = t.opts.HeldOut(t.Model)
+			}
+		}
+		s.StopReason = t.monitor.Observe(s)
+
+		if t.opts.OnIteration != nil {
+			if e := t.opts.OnIteration(s); e != nil {
+				return e
+			}
+		}
+		if len(s.StopReason) > 0 {
+			t.stopReason = s.StopReason
+			return nil
+		}
+	}
+	return nil
+}
+
+// StopReason returns why the last Run stopped before
+// Options.Iterations, or an empty string if it did not converge.
+func (t *Trainer) StopReason() string {
+	return t.stopReason
+}
+
+func (t *Trainer) runIteration() error {
+	if e := t.strategy.sample(t.iteration); e != nil {
+		return e
+	}
+
+	if t.iteration > t.opts.OptimStart {
+		optimizer := gibbs.NewOptimizer(t.Model.NumTopics())
+		for _, d := range t.Corpus {
+			optimizer.CollectDocumentStatistics(d)
+		}
+		optimizer.OptimizeTopicPriors(t.Model, t.opts.Shape, t.opts.Scale,
+			t.opts.OptimIter)
+	}
+	t.strategy.afterIteration()
+
+	if t.opts.AverageLag > 0 && t.iteration >= t.opts.AverageBurnIn &&
+		(t.iteration-t.opts.AverageBurnIn)%t.opts.AverageLag == 0 {
+		t.Averager.Add(t.Model)
+	}
+	if t.iteration >= t.opts.Iterations-t.opts.ThetaIters {
+		t.Thetas.Add(t.Corpus)
+	}
+	return nil
+}
+
+// Perplexity evaluates the perplexity of the corpus given the model.
+func (t *Trainer) Perplexity() float64 {
+	// Here we make use of Sampler.buildSmoothingOnlyBucket to
+	// accelerate the initialization of Evaluator.
+	eval := gibbs.NewEvaluator(t.Model, t.opts.CacheMB,
+		gibbs.NewSampler(t.Model))
+	logL, nW := t.strategy.evaluate(eval)
+	return math.Exp(-logL / float64(nW))
+}
+
+// newRand returns a random number generator whose source is t.src.
+func (t *Trainer) newRand() *rand.Rand {
+	return rand.New(t.src)
+}
@@ -0,0 +1,220 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"github.com/wangkuiyi/phoenix/core/utils"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// createTestingCorpus returns a corpus of 40 documents, each of
+// which has words from one half of the testing vocabulary, and a
+// model initialized with the corpus.
+func createTestingCorpus() ([]*gibbs.Document, *gibbs.Model) {
+	v, e := gibbs.CreateTestingVocabulary()
+	if e != nil {
+		panic(e)
+	}
+	rng := rand.New(utils.NewSource(1))
+	corpus := make([]*gibbs.Document, 40)
+	for i := range corpus {
+		words := make([]string, 10)
+		for j := range words {
+			words[j] = v.Tokens[2*(i%2)+rng.Intn(2)]
+		}
+		corpus[i] = gibbs.InitializeDocument(words, v, 2, rng)
+	}
+	return corpus, utils.InitializeModel(corpus, v, 2, 0.1, 0.01)
+}
+
+func testingOptions(strategy string) Options {
+	opts := DefaultOptions()
+	opts.Strategy = strategy
+	opts.Iterations = 20
+	opts.OptimStart = 5
+	opts.Shards = 3
+	opts.Partitions = 4
+	opts.Seed = 7
+	opts.AverageBurnIn = 10
+	opts.AverageLag = 2
+	opts.ThetaIters = 2
+	return opts
+}
+
+func TestTrainerResume(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	if e != nil {
+		t.Fatalf("Cannot create temp dir: %v", e)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, strategy := range []string{Serial, Parallel} {
+		corpus, m := createTestingCorpus()
+		tr, e := New(m, corpus, testingOptions(strategy))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e := tr.Run(context.Background()); e != nil {
+			t.Fatal(e)
+		}
+
+		// Stop after 10 iterations, checkpoint and resume.
+		corpus1, m1 := createTestingCorpus()
+		opts := testingOptions(strategy)
+		opts.OnIteration = func(s *IterationStats) error {
+			if s.Iteration == 9 {
+				return errors.New("stop")
+			}
+			return nil
+		}
+		tr1, e := New(m1, corpus1, opts)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e := tr1.Run(context.Background()); e == nil || e.Error() != "stop" {
+			t.Fatalf("%s: expecting error stop, got %v", strategy, e)
+		}
+		if tr1.Iteration() != 10 {
+			t.Fatalf("%s: expecting 10 iterations, got %d",
+				strategy, tr1.Iteration())
+		}
+
+		f := path.Join(dir, strategy)
+		if e := utils.SaveCheckpoint(tr1.Checkpoint(), f); e != nil {
+			t.Fatal(e)
+		}
+		c, e := utils.LoadCheckpoint(f)
+		if e != nil {
+			t.Fatal(e)
+		}
+		corpus2, _ := createTestingCorpus()
+		tr2, e := Resume(c, corpus2, testingOptions(strategy))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e := tr2.Run(context.Background()); e != nil {
+			t.Fatal(e)
+		}
+
+		if !reflect.DeepEqual(tr.Model, tr2.Model) {
+			t.Errorf("%s: resumed model differs", strategy)
+		}
+		if !reflect.DeepEqual(tr.Averager, tr2.Averager) {
+			t.Errorf("%s: resumed averager differs", strategy)
+		}
+		if !reflect.DeepEqual(tr.Thetas, tr2.Thetas) {
+			t.Errorf("%s: resumed thetas differ", strategy)
+		}
+	}
+}
+
+func TestTrainerResumePacked(t *testing.T) {
+	corpus, m := createTestingCorpus()
+	opts := testingOptions(Serial)
+	opts.Packed = true
+	opts.Iterations = 5
+	tr, e := New(m, corpus, opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := tr.Run(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+
+	// Resuming without Packed keeps packing as in the checkpoint.
+	corpus2, _ := createTestingCorpus()
+	tr2, e := Resume(tr.Checkpoint(), corpus2, testingOptions(Serial))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !tr2.opts.Packed {
+		t.Errorf("Expecting Packed restored from checkpoint")
+	}
+	if _, ok := tr2.Model.WordTopicHist(0).(*hist.Packed); !ok {
+		t.Errorf("Expecting hist.Packed, got %T",
+			tr2.Model.WordTopicHist(0))
+	}
+}
+
+func TestTrainerParallelIndependentOfShards(t *testing.T) {
+	var truth *gibbs.Model
+	for _, shards := range []int{1, 2, 4} {
+		corpus, m := createTestingCorpus()
+		opts := testingOptions(Parallel)
+		opts.Shards = shards
+		tr, e := New(m, corpus, opts)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if e := tr.Run(context.Background()); e != nil {
+			t.Fatal(e)
+		}
+		if truth == nil {
+			truth = tr.Model
+		} else if !reflect.DeepEqual(truth, tr.Model) {
+			t.Errorf("Model trained with %d shards differs", shards)
+		}
+	}
+}
+
+func TestTrainerPacked(t *testing.T) {
+	for _, strategy := range []string{Serial, Parallel} {
+		var truth []*gibbs.Document
+		for _, packed := range []bool{false, true} {
+			corpus, m := createTestingCorpus()
+			opts := testingOptions(strategy)
+			opts.Packed = packed
+			tr, e := New(m, corpus, opts)
+			if e != nil {
+				t.Fatal(e)
+			}
+			if e := tr.Run(context.Background()); e != nil {
+				t.Fatal(e)
+			}
+			if truth == nil {
+				truth = corpus
+			} else if !reflect.DeepEqual(truth, corpus) {
+				t.Errorf("%s: packed model samples differently", strategy)
+			}
+		}
+	}
+}
+
+func TestTrainerCancel(t *testing.T) {
+	corpus, m := createTestingCorpus()
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := testingOptions(Serial)
+	opts.OnIteration = func(s *IterationStats) error {
+		if !s.Evaluated || s.Perplexity <= 0 {
+			t.Errorf("Expecting perplexity, got %v", s)
+		}
+		if s.Iteration == 2 {
+			cancel()
+		}
+		return nil
+	}
+	tr, e := New(m, corpus, opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := tr.Run(ctx); e != context.Canceled {
+		t.Errorf("Expecting %v, got %v", context.Canceled, e)
+	}
+	if tr.Iteration() != 3 {
+		t.Errorf("Expecting 3 iterations, got %d", tr.Iteration())
+	}
+}
+
+func TestNewTrainerUnknownStrategy(t *testing.T) {
+	corpus, m := createTestingCorpus()
+	if _, e := New(m, corpus, testingOptions("unknown")); e == nil {
+		t.Errorf("Expecting error for unknown strategy")
+	}
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"encoding/gob"
+	"fmt"
+	cmprs "github.com/wangkuiyi/compress_io"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/hist"
+	"log"
+	"os"
+	"path"
+)
+
+// Checkpoint contains everything a trainer needs to continue training
+// bit-for-bit from where it stopped.  Document words are not saved,
+// as they are reloaded from the corpus file.
+type Checkpoint struct {
+	Model      *gibbs.Model
+	Topics     [][]int32             // topic assignments of documents
+	TopicHists []*hist.OrderedSparse // document topic histograms
+	Iteration  int                   // the next iteration to run
+	RNG        Source
+
+	// Sampling and hyperparameter optimization settings.
+	Kernel     string
+	Packed     bool
+	OptimStart int
+	OptimIter  int
+	Shape      float64
+	Scale      float64
+	Partitions int   // used by multithread only
+	Seed       int64 // used by multithread only
+
+	// Optional accumulators of averaged models and document topic
+	// distributions.
+	Averager *gibbs.Averager
+	Thetas   *gibbs.ThetaAccumulator
+}
+
+// NewCheckpoint creates a checkpoint that shares model and
+// accumulators, but copies topic assignments of corpus.
+func NewCheckpoint(model *gibbs.Model, corpus []*gibbs.Document,
+	iteration int, rng *Source) *Checkpoint {
+	c := &Checkpoint{
+		Model:      model,
+		Topics:     make([][]int32, len(corpus)),
+		TopicHists: make([]*hist.OrderedSparse, len(corpus)),
+		Iteration:  iteration,
+		RNG:        *rng,
+	}
+	for i, d := range corpus {
+		c.Topics[i] = append([]int32(nil), d.Topics...)
+		c.TopicHists[i] = d.TopicHist.Clone().(*hist.OrderedSparse)
+	}
+	return c
+}
+
+// Restore sets topic assignments of corpus, which must be loaded from
+// the same corpus file with the same options as when c was created.
+func (c *Checkpoint) Restore(corpus []*gibbs.Document) error {
+	if len(corpus) != len(c.Topics) {
+		return fmt.Errorf("Corpus has %d documents, but checkpoint has %d",
+			len(corpus), len(c.Topics))
+	}
+	for i, d := range corpus {
+		if len(c.Topics[i]) != d.Len() {
+			return fmt.Errorf("Document %d has %d words, but checkpoint has %d",
+				i, d.Len(), len(c.Topics[i]))
+		}
+	}
+	for i, d := range corpus {
+		d.Topics = c.Topics[i]
+		d.TopicHist = c.TopicHists[i]
+	}
+	return nil
+}
+
+// SaveCheckpoint writes c into a temporary file and renames it to
+// filename, so an interrupted saving does not corrupt an existing
+// checkpoint.
+func SaveCheckpoint(c *Checkpoint, filename string) error {
+	tmp := filename + ".tmp"
+	f, e := os.Create(tmp)
+	w := cmprs.NewWriter(f, e, path.Ext(filename))
+	if w == nil {
+		return fmt.Errorf("Cannot create file %s: %v", tmp, e)
+	}
+	if e := gob.NewEncoder(w).Encode(c); e != nil {
+		w.Close()
+		return fmt.Errorf("Failed encoding checkpoint: %v", e)
+	}
+	if e := w.Close(); e != nil {
+		return fmt.Errorf("Failed writing %s: %v", tmp, e)
+	}
+	if e := os.Rename(tmp, filename); e != nil {
+		return fmt.Errorf("Cannot rename %s to %s: %v", tmp, filename, e)
+	}
+	log.Printf("Saved checkpoint of iteration %d to %s.", c.Iteration, filename)
+	return nil
+}
+
+func LoadCheckpoint(filename string) (*Checkpoint, error) {
+	f, e := os.Open(filename)
+	r := cmprs.NewReader(f, e, path.Ext(filename))
+	if r == nil {
+		return nil, fmt.Errorf("Cannot open checkpoint %s: %v", filename, e)
+	}
+	defer r.Close()
+
+	c := new(Checkpoint)
+	if e := gob.NewDecoder(r).Decode(c); e != nil {
+		return nil, fmt.Errorf("Cannot decode checkpoint %s: %v", filename, e)
+	}
+	log.Printf("Loaded checkpoint of iteration %d from %s.",
+		c.Iteration, filename)
+	return c, nil
+}
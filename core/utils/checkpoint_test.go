@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	if e != nil {
+		t.Fatalf("Cannot create temp dir: %v", e)
+	}
+	defer os.RemoveAll(dir)
+
+	v, e := gibbs.CreateTestingVocabulary()
+	if e != nil {
+		t.Fatalf("CreateTestingVocabulary: %v", e)
+	}
+	f := createTempCorpus(dir, "", "apple orange\ncat tiger\napple cat\n")
+	load := func() ([]*gibbs.Document, *gibbs.Model, *Source) {
+		src := NewSource(-1)
+		corpus := LoadCorpusOrDie(f, v, 2, 1, -1, rand.New(src))
+		return corpus, InitializeModel(corpus, v, 2, 0.1, 0.01), src
+	}
+	sample := func(m *gibbs.Model, corpus []*gibbs.Document, src *Source,
+		from, to int) {
+		s := gibbs.NewSampler(m)
+		rng := rand.New(src)
+		for iter := from; iter < to; iter++ {
+			s.AfterOptimization()
+			for _, d := range corpus {
+				s.Sample(d, rng)
+			}
+		}
+	}
+
+	// Train 20 iterations without interruption.
+	corpus, m, src := load()
+	sample(m, corpus, src, 0, 20)
+
+	// Train 10 iterations, checkpoint, resume and train another 10.
+	corpus1, m1, src1 := load()
+	sample(m1, corpus1, src1, 0, 10)
+	ckpt := path.Join(dir, "checkpoint.gz")
+	if e := SaveCheckpoint(NewCheckpoint(m1, corpus1, 10, src1), ckpt); e != nil {
+		t.Fatal(e)
+	}
+
+	corpus2, _, _ := load()
+	c, e := LoadCheckpoint(ckpt)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Restore(corpus2); e != nil {
+		t.Fatal(e)
+	}
+	sample(c.Model, corpus2, &c.RNG, c.Iteration, 20)
+
+	if !reflect.DeepEqual(m, c.Model) {
+		t.Errorf("Expecting model\n%v\ngot\n%v", m, c.Model)
+	}
+	for i := range corpus {
+		if !reflect.DeepEqual(corpus[i], corpus2[i]) {
+			t.Errorf("Document %d: expecting %v, got %v",
+				i, corpus[i], corpus2[i])
+		}
+	}
+}
+
+func TestCheckpointRestoreMismatch(t *testing.T) {
+	v, _ := gibbs.CreateTestingVocabulary()
+	rng := rand.New(NewSource(1))
+	d := gibbs.InitializeDocument([]string{"apple", "cat"}, v, 2, rng)
+	c := NewCheckpoint(gibbs.CreateTestingModel(), []*gibbs.Document{d},
+		0, NewSource(1))
+
+	e := gibbs.InitializeDocument([]string{"apple"}, v, 2, rng)
+	if c.Restore([]*gibbs.Document{e}) == nil {
+		t.Errorf("Expecting error restoring a different corpus")
+	}
+	if c.Restore(nil) == nil {
+		t.Errorf("Expecting error restoring a different corpus")
+	}
+}
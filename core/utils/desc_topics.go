@@ -14,9 +14,10 @@ func DescribeTopics(m *gibbs.Model, v *gibbs.Vocabulary,
 
 	log.Printf("Generating topic descriptions ... ")
 	descs := make([]*TopicDesc, m.NumTopics())
+	x := gibbs.NewTopicIndex(m)
 
 	parallel.ForN(0, m.NumTopics(), 1, 2*runtime.NumCPU(), func(topic int) {
-		h := m.GetTopWords(topic)
+		h := x.TopWords(topic)
 		if h == nil {
 			panic(fmt.Sprintf("topic %d got empty word list", topic))
 		}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// FileMissingError is returned by loaders if a file does not exist
+// or cannot be opened.
+type FileMissingError struct {
+	Filename string
+	Err      error
+}
+
+func (e *FileMissingError) Error() string {
+	return fmt.Sprintf("Cannot open %s: %v", e.Filename, e.Err)
+}
+
+func (e *FileMissingError) Unwrap() error { return e.Err }
+
+// CorruptModelError is returned by LoadModel if a model file cannot
+// be decoded, or the decoded model is inconsistent.
+type CorruptModelError struct {
+	Filename string
+	Err      error
+}
+
+func (e *CorruptModelError) Error() string {
+	return fmt.Sprintf("Corrupt model %s: %v", e.Filename, e.Err)
+}
+
+func (e *CorruptModelError) Unwrap() error { return e.Err }
+
+// VocabMismatchError is returned by CheckModel if a model is not
+// trained with a vocabulary.
+type VocabMismatchError struct {
+	VocabSize      int
+	ModelVocabSize int
+}
+
+func (e *VocabMismatchError) Error() string {
+	return fmt.Sprintf("Model has %d tokens, but vocabulary has %d",
+		e.ModelVocabSize, e.VocabSize)
+}
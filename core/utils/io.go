@@ -3,6 +3,7 @@ package utils
 import (
 	"bufio"
 	"encoding/gob"
+	"fmt"
 	cmprs "github.com/wangkuiyi/compress_io"
 	"github.com/wangkuiyi/phoenix/core/gibbs"
 	"io"
@@ -10,88 +11,164 @@ import (
 	"math/rand"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 )
 
-func LoadVocabOrDie(filename string) *gibbs.Vocabulary {
-	log.Printf("Loading vocab %s ... ", filename)
-
+// openFile opens filename for reading, and decompresses its content
+// if filename ends with .gz.
+func openFile(filename string) (io.ReadCloser, error) {
 	f, e := os.Open(filename)
+	if e != nil {
+		return nil, &FileMissingError{filename, e}
+	}
 	r := cmprs.NewReader(f, e, path.Ext(filename))
 	if r == nil {
-		log.Fatalf("Cannot open vocab file %s: %v", filename, e)
+		f.Close()
+		return nil, fmt.Errorf("Cannot decompress %s", filename)
 	}
+	return r, nil
+}
 
+func LoadVocabOrDie(filename string) *gibbs.Vocabulary {
+	vocab, e := LoadVocab(filename)
+	if e != nil {
+		log.Fatal(e)
+	}
+	return vocab
+}
+
+func LoadVocab(filename string) (*gibbs.Vocabulary, error) {
+	log.Printf("Loading vocab %s ... ", filename)
+
+	r, e := openFile(filename)
+	if e != nil {
+		return nil, e
+	}
 	defer r.Close()
+
 	vocab := gibbs.NewVocabulary()
 	if e := vocab.Load(r); e != nil {
-		log.Fatalf("Failed loading vocab file %s: %v", filename, e)
+		return nil, fmt.Errorf("Failed loading vocab file %s: %v", filename, e)
 	}
 
 	log.Println("Done loading vocabulary.")
-	return vocab
+	return vocab, nil
 }
 
 func LoadCorpusOrDie(filename string, vocab *gibbs.Vocabulary, topics int,
 	minLen, maxLen int, rng *rand.Rand) []*gibbs.Document {
+	corpus, _ := LoadIndexedCorpusOrDie(filename, vocab, topics,
+		minLen, maxLen, rng)
+	return corpus
+}
 
-	log.Printf("Loading corpus %s ... ", filename)
+func LoadCorpus(filename string, vocab *gibbs.Vocabulary, topics int,
+	minLen, maxLen int, rng *rand.Rand) ([]*gibbs.Document, error) {
+	corpus, _, e := LoadIndexedCorpus(filename, vocab, topics,
+		minLen, maxLen, rng)
+	return corpus, e
+}
 
-	f, e := os.Open(filename)
-	r := cmprs.NewReader(f, e, path.Ext(filename))
-	if r == nil {
-		log.Fatalf("Cannot open corpus file %s: %v", filename, e)
+// LoadIndexedCorpusOrDie is the same as LoadCorpusOrDie, but also
+// returns the 0-based line number of each loaded document, which
+// identifies documents in outputs like per-document topic
+// distributions.
+func LoadIndexedCorpusOrDie(filename string, vocab *gibbs.Vocabulary,
+	topics int, minLen, maxLen int, rng *rand.Rand) (
+	[]*gibbs.Document, []int) {
+	corpus, lines, e := LoadIndexedCorpus(filename, vocab, topics,
+		minLen, maxLen, rng)
+	if e != nil {
+		log.Fatal(e)
 	}
+	return corpus, lines
+}
+
+func LoadIndexedCorpus(filename string, vocab *gibbs.Vocabulary,
+	topics int, minLen, maxLen int, rng *rand.Rand) (
+	[]*gibbs.Document, []int, error) {
+
+	log.Printf("Loading corpus %s ... ", filename)
 
+	r, e := openFile(filename)
+	if e != nil {
+		return nil, nil, e
+	}
 	defer r.Close()
+
 	corpus := make([]*gibbs.Document, 0)
+	lines := make([]int, 0)
 	scanned := 0
 	s := bufio.NewReader(r)
 	for {
 		line, e := s.ReadString('\n')
 		if e != nil {
 			if e != io.EOF {
-				log.Fatal("Error reading", filename, ":", e)
+				return nil, nil, fmt.Errorf("Error reading %s: %v", filename, e)
 			} else {
 				break
 			}
 		}
-		scanned++
-
 		tokens := strings.Fields(line)
 		d := gibbs.InitializeDocument(tokens, vocab, topics, rng)
 		if ((minLen > 0 && d.Len() >= minLen) || minLen <= 0) &&
 			((maxLen > 0 && d.Len() <= maxLen) || maxLen <= 0) {
 			corpus = append(corpus, d)
+			lines = append(lines, scanned)
 		}
+		scanned++
 	}
 
-	if len(corpus) > 0 {
-		log.Printf("Done loading corpus: %d out of %d.", len(corpus), scanned)
-	} else {
-		log.Fatal("corpus contain no valid document!")
+	if len(corpus) <= 0 {
+		return nil, nil, fmt.Errorf("Corpus %s contains no valid document",
+			filename)
 	}
-	return corpus
+	log.Printf("Done loading corpus: %d out of %d.", len(corpus), scanned)
+	return corpus, lines, nil
 }
 
 func LoadModelOrDie(filename string) *gibbs.Model {
+	m, e := LoadModel(filename)
+	if e != nil {
+		log.Fatal(e)
+	}
+	return m
+}
+
+// LoadModel returns a *FileMissingError if filename cannot be opened,
+// or a *CorruptModelError if it does not contain a valid model.
+func LoadModel(filename string) (*gibbs.Model, error) {
 	log.Printf("Loading model %s ...", filename)
-	m := new(gibbs.Model)
 
-	f, e := os.Open(filename)
-	r := cmprs.NewReader(f, e, path.Ext(filename))
-	if r == nil {
-		log.Fatalf("Cannot open model file %s: %v", filename, e)
+	r, e := openFile(filename)
+	if e != nil {
+		if _, ok := e.(*FileMissingError); ok {
+			return nil, e
+		}
+		return nil, &CorruptModelError{filename, e}
 	}
 	defer r.Close()
 
-	dec := gob.NewDecoder(r)
-	if e := dec.Decode(m); e != nil {
-		log.Fatalf("Cannot decode model: %v", e)
+	m := new(gibbs.Model)
+	if e := gob.NewDecoder(r).Decode(m); e != nil {
+		return nil, &CorruptModelError{filename, e}
+	}
+	if e := m.Validate(); e != nil {
+		return nil, &CorruptModelError{filename, e}
 	}
 
 	log.Printf("Done. %d topics %d tokens.", m.NumTopics(), m.VocabSize())
-	return m
+	return m, nil
+}
+
+// CheckModel returns a *VocabMismatchError if m is not trained with
+// vocab, i.e., m.VocabSize() != vocab.Len().
+func CheckModel(m *gibbs.Model, vocab *gibbs.Vocabulary) error {
+	if m.VocabSize() != vocab.Len() {
+		return &VocabMismatchError{vocab.Len(), m.VocabSize()}
+	}
+	return nil
 }
 
 func InitializeModel(corpus []*gibbs.Document, vocab *gibbs.Vocabulary,
@@ -106,23 +183,81 @@ func InitializeModel(corpus []*gibbs.Document, vocab *gibbs.Vocabulary,
 	return model
 }
 
-func SaveModel(model *gibbs.Model, filename string) {
-	if len(filename) > 0 {
-		f, e := os.Create(filename)
-		w := cmprs.NewWriter(f, e, path.Ext(filename))
-		if w == nil {
-			log.Printf("Cannot create file %s: %v", filename, e)
-		} else {
-			defer func() {
-				w.Close()
-				log.Printf("Saved model to %s.", filename)
-			}()
-			enc := gob.NewEncoder(w)
-			if e := enc.Encode(model); e != nil {
-				log.Printf("Failed encoding model: %v", e)
-			}
+// SaveModel saves model into filename, which is compressed if it
+// ends with .gz.  It does nothing if filename is empty.
+func SaveModel(model *gibbs.Model, filename string) error {
+	if len(filename) <= 0 {
+		return nil
+	}
+
+	f, e := os.Create(filename)
+	w := cmprs.NewWriter(f, e, path.Ext(filename))
+	if w == nil {
+		return fmt.Errorf("Cannot create file %s: %v", filename, e)
+	}
+	if e := gob.NewEncoder(w).Encode(model); e != nil {
+		w.Close()
+		return fmt.Errorf("Failed encoding model to %s: %v", filename, e)
+	}
+	if e := w.Close(); e != nil {
+		return fmt.Errorf("Failed writing %s: %v", filename, e)
+	}
+	log.Printf("Saved model to %s.", filename)
+	return nil
+}
+
+// SaveAveragedModel saves the averaged model of a, whose fractional
+// counts are represented in fixed-point with resolution.  It does
+// nothing if filename is empty or a has no samples.
+func SaveAveragedModel(a *gibbs.Averager, resolution float64,
+	filename string) error {
+	if len(filename) <= 0 {
+		return nil
+	}
+	if a.Samples() <= 0 {
+		log.Printf("No sample averaged, not saving %s.", filename)
+		return nil
+	}
+	m, e := a.Model(resolution)
+	if e != nil {
+		return fmt.Errorf("Cannot average %d samples: %v", a.Samples(), e)
+	}
+	log.Printf("Averaged %d samples.", a.Samples())
+	return SaveModel(m, filename)
+}
+
+// SaveTheta saves averaged topic distributions of corpus accumulated
+// by a, one document a line, keyed by lines[i], the line number of
+// the i-th document in the corpus file.  It does nothing if filename
+// is empty.
+func SaveTheta(a *gibbs.ThetaAccumulator, m *gibbs.Model, lines []int,
+	filename string) error {
+	if len(filename) <= 0 {
+		return nil
+	}
+
+	f, e := os.Create(filename)
+	if e != nil {
+		return fmt.Errorf("Cannot create file %s: %v", filename, e)
+	}
+
+	w := bufio.NewWriter(f)
+	for i, l := range lines {
+		if e := gibbs.WriteTheta(w, strconv.Itoa(l), a.Theta(i, m)); e != nil {
+			f.Close()
+			return fmt.Errorf("Failed writing %s: %v", filename, e)
 		}
 	}
+	if e := w.Flush(); e != nil {
+		f.Close()
+		return fmt.Errorf("Failed writing %s: %v", filename, e)
+	}
+	if e := f.Close(); e != nil {
+		return fmt.Errorf("Failed writing %s: %v", filename, e)
+	}
+	log.Printf("Saved theta of %d documents averaged over %d iterations "+
+		"to %s.", len(lines), a.Samples(), filename)
+	return nil
 }
 
 type Trans map[string]string
@@ -141,30 +276,39 @@ func TranslatedVocab(v *gibbs.Vocabulary, tr Trans) *gibbs.Vocabulary {
 }
 
 func LoadTranslationOrDie(filename string) Trans {
+	trans, e := LoadTranslation(filename)
+	if e != nil {
+		log.Fatal(e)
+	}
+	return trans
+}
+
+func LoadTranslation(filename string) (Trans, error) {
 	log.Printf("Loading translation %s ...", filename)
-	trans := make(map[string]string)
 
-	f, e := os.Open(filename)
-	if r := cmprs.NewReader(f, e, path.Ext(filename)); r == nil {
-		log.Fatalf("Cannot load from %s", filename)
-	} else {
-		defer r.Close()
-		s := bufio.NewScanner(r)
-		for s.Scan() {
-			fs := strings.Fields(s.Text())
-			if len(fs) < 2 {
-				log.Fatalf("%v has less than 2 fields", fs)
-			}
-			if _, exist := trans[fs[0]]; exist {
-				log.Fatalf("Found duplicated company Id (%s) in %s", fs[0], fs)
-			}
-			trans[fs[0]] = strings.Join(fs[1:len(fs)], " ")
+	r, e := openFile(filename)
+	if e != nil {
+		return nil, e
+	}
+	defer r.Close()
+
+	trans := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fs := strings.Fields(s.Text())
+		if len(fs) < 2 {
+			return nil, fmt.Errorf("%v has less than 2 fields", fs)
 		}
-		if e := s.Err(); e != nil {
-			log.Fatalf("Reading %s error: %v", filename, e)
+		if _, exist := trans[fs[0]]; exist {
+			return nil, fmt.Errorf("Found duplicated company Id (%s) in %s",
+				fs[0], fs)
 		}
+		trans[fs[0]] = strings.Join(fs[1:len(fs)], " ")
+	}
+	if e := s.Err(); e != nil {
+		return nil, fmt.Errorf("Reading %s error: %v", filename, e)
 	}
 
 	log.Printf("Done loading translation,  %d entries.", len(trans))
-	return trans
+	return trans, nil
 }
@@ -3,8 +3,10 @@ package utils
 import (
 	cmprs "github.com/wangkuiyi/compress_io"
 	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"github.com/wangkuiyi/phoenix/core/hist"
 	"io/ioutil"
 	"log"
+	"math"
 	"math/rand"
 	"os"
 	"path"
@@ -125,6 +127,26 @@ func TestLoadCorpusOrDie(t *testing.T) {
 
 }
 
+func TestLoadIndexedCorpusOrDie(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	if e != nil {
+		t.Fatalf("Cannot create temp dir: %v", e)
+	}
+	defer os.RemoveAll(dir)
+
+	v, e := gibbs.CreateTestingVocabulary()
+	if e != nil {
+		t.Fatalf("CreateTestingVocabulary: %v", e)
+	}
+	f := createTempCorpus(dir, "", "apple\nunknown\n\norange cat\n")
+	rng := rand.New(rand.NewSource(1))
+	c, lines := LoadIndexedCorpusOrDie(f, v, 2, 1, 50, rng)
+	if len(c) != 2 || !reflect.DeepEqual(lines, []int{0, 3}) {
+		t.Errorf("Expecting 2 documents at lines [0 3], got %d at %v",
+			len(c), lines)
+	}
+}
+
 func TestSaveAndLoadModelOrDie(t *testing.T) {
 	dir, e := ioutil.TempDir("", "")
 	if e != nil {
@@ -135,20 +157,115 @@ func TestSaveAndLoadModelOrDie(t *testing.T) {
 	m := gibbs.CreateTestingModel()
 
 	gzFile := path.Join(dir, "model.gz")
-	SaveModel(m, gzFile)
+	if e := SaveModel(m, gzFile); e != nil {
+		t.Fatal(e)
+	}
 	m1 := LoadModelOrDie(gzFile)
 	if !reflect.DeepEqual(*m, *m1) {
 		t.Errorf("Expecting\n%v\ngot\n%v\n", *m, *m1)
 	}
 
 	plainFile := path.Join(dir, "model")
-	SaveModel(m, plainFile)
+	if e := SaveModel(m, plainFile); e != nil {
+		t.Fatal(e)
+	}
 	m1 = LoadModelOrDie(plainFile)
 	if !reflect.DeepEqual(*m, *m1) {
 		t.Errorf("Expecting\n%v\ngot\n%v\n", *m, *m1)
 	}
 }
 
+// TestLoadModelWithInt32Counts checks that models saved when counts
+// in hist.Sparse were int32 load into 64-bit counts.
+func TestLoadModelWithInt32Counts(t *testing.T) {
+	m, e := LoadModel("testdata/model_int32")
+	if e != nil {
+		t.Fatal(e)
+	}
+	truth := []hist.Hist{
+		hist.Sparse{0: 3}, nil, hist.Sparse{0: 5}, hist.Sparse{0: 2, 1: 7}}
+	if !reflect.DeepEqual(m.WordTopicHists, truth) {
+		t.Errorf("Expecting %v, got %v", truth, m.WordTopicHists)
+	}
+
+	// Counts larger than MaxInt32 are now allowed.
+	m.WordTopicHist(0).Inc(0, math.MaxInt32)
+	m.GlobalTopicHist.Inc(0, math.MaxInt32)
+	if c := m.WordTopicHist(0).At(0); c != math.MaxInt32+3 {
+		t.Errorf("Expecting %d, got %d", int64(math.MaxInt32+3), c)
+	}
+	if e := m.Validate(); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	if e != nil {
+		t.Fatalf("Cannot create temp dir: %v", e)
+	}
+	defer os.RemoveAll(dir)
+
+	missing := path.Join(dir, "missing")
+	if _, e := LoadModel(missing); !isFileMissing(e) {
+		t.Errorf("Expecting *FileMissingError, got %v", e)
+	}
+	if _, e := LoadVocab(missing); !isFileMissing(e) {
+		t.Errorf("Expecting *FileMissingError, got %v", e)
+	}
+	if _, e := LoadTranslation(missing); !isFileMissing(e) {
+		t.Errorf("Expecting *FileMissingError, got %v", e)
+	}
+	v, _ := gibbs.CreateTestingVocabulary()
+	rng := rand.New(rand.NewSource(1))
+	if _, e := LoadCorpus(missing, v, 2, 1, 50, rng); !isFileMissing(e) {
+		t.Errorf("Expecting *FileMissingError, got %v", e)
+	}
+
+	for _, ext := range []string{"", ".gz"} {
+		corrupt := createTempFile(dir, "model", ext, "not a model")
+		if _, e := LoadModel(corrupt); !isCorruptModel(e) {
+			t.Errorf("Expecting *CorruptModelError, got %v", e)
+		}
+	}
+
+	if e := SaveModel(gibbs.CreateTestingModel(), missing+"/model"); e == nil {
+		t.Errorf("Expecting error saving into a missing dir")
+	}
+	a := gibbs.NewAverager(2, 4)
+	a.Add(gibbs.CreateTestingModel())
+	if e := SaveAveragedModel(a, 100, missing+"/avg"); e == nil {
+		t.Errorf("Expecting error saving averaged model into a missing dir")
+	}
+	th := gibbs.NewThetaAccumulator(0)
+	if e := SaveTheta(th, gibbs.CreateTestingModel(), nil,
+		missing+"/theta"); e == nil {
+		t.Errorf("Expecting error saving theta into a missing dir")
+	}
+}
+
+func TestCheckModel(t *testing.T) {
+	v, _ := gibbs.CreateTestingVocabulary()
+	m := gibbs.CreateTestingModel()
+	if e := CheckModel(m, v); e != nil {
+		t.Errorf("Expecting nil, got %v", e)
+	}
+	m = gibbs.NewModel(2, v.Len()+1, 0.1, 0.01)
+	if _, ok := CheckModel(m, v).(*VocabMismatchError); !ok {
+		t.Errorf("Expecting *VocabMismatchError")
+	}
+}
+
+func isFileMissing(e error) bool {
+	_, ok := e.(*FileMissingError)
+	return ok
+}
+
+func isCorruptModel(e error) bool {
+	_, ok := e.(*CorruptModelError)
+	return ok
+}
+
 func createTempVocab(dir, ext, content string) string {
 	return createTempFile(dir, "vocab", ext, content)
 }
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"encoding/binary"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"hash/fnv"
+)
+
+// Source is gibbs.Source, which is defined in package gibbs so that
+// samplers can use it without importing utils.
+type Source = gibbs.Source
+
+func NewSource(seed int64) *Source {
+	return gibbs.NewSource(seed)
+}
+
+// DocumentSeed derives the seed of the random number stream used to
+// sample a document in an iteration from the seed of a job, like
+// Interpreter.Interpret derives one from a hash of the document.  So
+// the stream does not depend on which goroutine samples the document.
+func DocumentSeed(seed int64, iteration, doc int) int64 {
+	var b [24]byte
+	binary.LittleEndian.PutUint64(b[0:], uint64(seed))
+	binary.LittleEndian.PutUint64(b[8:], uint64(iteration))
+	binary.LittleEndian.PutUint64(b[16:], uint64(doc))
+	h := fnv.New64a()
+	h.Write(b[:])
+	return int64(h.Sum64())
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSourceRestore(t *testing.T) {
+	s := NewSource(-1)
+	r := rand.New(s)
+	for i := 0; i < 100; i++ {
+		r.Float64()
+	}
+
+	saved := *s
+	want := make([]int, 100)
+	for i := range want {
+		want[i] = r.Intn(1000)
+	}
+
+	restored := saved
+	r = rand.New(&restored)
+	for i := range want {
+		if got := r.Intn(1000); got != want[i] {
+			t.Fatalf("Draw %d: expecting %d, got %d", i, want[i], got)
+		}
+	}
+}
+
+func TestDocumentSeed(t *testing.T) {
+	s := DocumentSeed(-1, 2, 3)
+	if s != DocumentSeed(-1, 2, 3) {
+		t.Errorf("DocumentSeed is not deterministic")
+	}
+	if s == DocumentSeed(-1, 3, 2) || s == DocumentSeed(-1, 2, 4) ||
+		s == DocumentSeed(0, 2, 3) {
+		t.Errorf("Expecting different seeds for different inputs")
+	}
+}
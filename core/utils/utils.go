@@ -22,13 +22,18 @@ type Iteration struct {
 	StartTime  time.Time
 	Duration   time.Duration
 	Perplexity float64
+	StopReason string // why training stopped after this iteration
 }
 type Iterations []*Iteration
 
 func (is *Iterations) String() string { // Implements expvar.Var
 	var buf bytes.Buffer
 	for i, iter := range *is {
-		fmt.Fprintf(&buf, "%05d: %s\t%s\n", i, iter.StartTime, iter.Duration)
+		fmt.Fprintf(&buf, "%05d: %s\t%s", i, iter.StartTime, iter.Duration)
+		if len(iter.StopReason) > 0 {
+			fmt.Fprintf(&buf, "\tstopped: %s", iter.StopReason)
+		}
+		buf.WriteString("\n")
 	}
 	return buf.String()
 }
@@ -101,9 +101,13 @@ type Squad struct {
 // Notice that the estimated prior and the global topic histogram are
 // duplicated and exist in every model shard file, as them exist in
 // the memory space of every Sampler instance.
+//
+// Loader.Theta writes the topic distributions of documents in a shard
+// into theta-<shard> in the directory of an iteration.
 const (
 	MODEL_FILE = "model"
 	LOGLL_FILE = "logll"
+	THETA_FILE = "theta"
 )
 
 func (c *Config) Validate() error {
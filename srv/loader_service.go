@@ -9,6 +9,7 @@ import (
 	"github.com/wangkuiyi/parallel"
 	"github.com/wangkuiyi/phoenix/core/gibbs"
 	"hash/fnv"
+	"io"
 	"log"
 	"math/rand"
 	"net"
@@ -105,10 +106,6 @@ func (l *Loader) Init(shard string, _ *int) error {
 		return fmt.Errorf("%s create shard %s: %v", me, oshard, e)
 	}
 	b := bufio.NewWriter(o)
-	defer func() {
-		b.Flush()
-		o.Close()
-	}()
 
 	// Load vocabulary and creating an empty model.
 	v := gibbs.NewVocabulary()
@@ -160,3 +157,66 @@ func (l *Loader) Init(shard string, _ *int) error {
 
 	return nil
 }
+
+// ThetaArgs identifies a shard of documents, which were written by
+// Loader.Init or samplers into the directory of an iteration.
+type ThetaArgs struct {
+	Shard     string
+	Iteration int
+}
+
+// Theta writes the topic distributions of documents in a shard, one
+// document a line keyed by <shard>:<index>, where index is the
+// 0-based index of the document in the shard.  Distributions are
+// smoothed with the symmetric topic prior l.cfg.TopicPrior.
+func (l *Loader) Theta(args *ThetaArgs, _ *int) error {
+	dir := path.Join(l.cfg.JobDir, fmt.Sprintf("%05d", args.Iteration))
+	ishard := path.Join(dir, args.Shard)
+	in, e := file.Open(ishard)
+	if e != nil {
+		return fmt.Errorf("%s open shard %s: %v", l.me, ishard, e)
+	}
+	defer in.Close()
+
+	oshard := path.Join(dir, THETA_FILE+"-"+args.Shard)
+	o, e := file.Create(oshard)
+	if e != nil {
+		return fmt.Errorf("%s create %s: %v", l.me, oshard, e)
+	}
+	b := bufio.NewWriter(o)
+	defer func() {
+		b.Flush()
+		o.Close()
+	}()
+
+	prior := make([]float64, l.cfg.NumTopics)
+	for i := range prior {
+		prior[i] = l.cfg.TopicPrior
+	}
+	priorSum := l.cfg.TopicPrior * float64(l.cfg.NumTopics)
+
+	dec := gob.NewDecoder(bufio.NewReader(in))
+	for i := 0; ; i++ {
+		var d gibbs.Document
+		if e := dec.Decode(&d); e == io.EOF {
+			break
+		} else if e != nil {
+			o.Close()
+			return fmt.Errorf("%s decode document %d in %s: %v",
+				l.me, i, ishard, e)
+		}
+		key := fmt.Sprintf("%s:%d", args.Shard, i)
+		if e := gibbs.WriteTheta(b, key, d.Theta(prior, priorSum)); e != nil {
+			o.Close()
+			return fmt.Errorf("%s write %s: %v", l.me, oshard, e)
+		}
+	}
+	if e := b.Flush(); e != nil {
+		o.Close()
+		return fmt.Errorf("%s write %s: %v", l.me, oshard, e)
+	}
+	if e := o.Close(); e != nil {
+		return fmt.Errorf("%s close %s: %v", l.me, oshard, e)
+	}
+	return nil
+}
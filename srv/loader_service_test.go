@@ -0,0 +1,53 @@
+package srv
+
+import (
+	"bufio"
+	"encoding/gob"
+	"github.com/wangkuiyi/file"
+	"github.com/wangkuiyi/file/inmemfs"
+	"github.com/wangkuiyi/phoenix/core/gibbs"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"testing"
+)
+
+func TestLoaderTheta(t *testing.T) {
+	c := createTestingConfig()
+	c.NumTopics = 2
+	c.TopicPrior = 0.1
+
+	inmemfs.Format()
+	v, _ := gibbs.CreateTestingVocabulary()
+	rng := rand.New(rand.NewSource(1))
+	f, e := file.Create(path.Join(c.JobDir, "00000", "00000"))
+	if e != nil {
+		t.Fatalf("Unexpected error in create file: %v", e)
+	}
+	b := bufio.NewWriter(f)
+	en := gob.NewEncoder(b)
+	for _, words := range [][]string{{"apple", "orange"}, {"cat"}} {
+		d := gibbs.InitializeDocument(words, v, c.NumTopics, rng)
+		if e := en.Encode(d); e != nil {
+			t.Fatalf("Cannot encode document: %v", e)
+		}
+	}
+	b.Flush()
+	f.Close()
+
+	l := &Loader{cfg: c, me: "loader"}
+	if e := l.Theta(&ThetaArgs{"00000", 0}, nil); e != nil {
+		t.Fatalf("Unexpected error: %v", e)
+	}
+
+	r, e := file.Open(path.Join(c.JobDir, "00000", THETA_FILE+"-00000"))
+	if e != nil {
+		t.Fatalf("Cannot open theta file: %v", e)
+	}
+	defer r.Close()
+	s, _ := ioutil.ReadAll(r)
+	truth := "00000:0 1:0.9545454545454545\n00000:1 1:0.9166666666666667\n"
+	if string(s) != truth {
+		t.Errorf("Expecting %q, got %q", truth, s)
+	}
+}